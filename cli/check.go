@@ -27,28 +27,36 @@ import (
 
 func newCheckCommand() *cobra.Command {
 	withoutTime := false
+	ambiguous := false
+	input := logInput{}
+	component := componentFlag{}
 	cmd := &cobra.Command{
-		Use: "check <component>",
+		Use: "check [component]",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if len(args) == 0 {
-				return cmd.Help()
+			if len(args) > 0 {
+				component.name = args[0]
 			}
-			comp, err := event.GetComponentType(args[0])
+			p, err := input.open()
 			if err != nil {
 				return err
 			}
-			p := parser.NewStreamParser(os.Stdin)
+			defer p.Close()
 			if withoutTime {
 				p = p.WithoutTime()
 			}
-			em, err := event.NewEventManager(comp)
-			assert(err)
+			em, logs, err := component.eventManager(p)
+			if err != nil {
+				return err
+			}
 
 			for {
-				log, err := p.Next()
+				log, err := logs.Next()
 				if log == nil && err == nil {
 					break
 				}
+				if err != nil && !isParseError(err) {
+					return err
+				}
 				if log == nil || err != nil {
 					fmt.Println(err)
 					continue
@@ -56,21 +64,27 @@ func newCheckCommand() *cobra.Command {
 				if ignore(log) {
 					continue
 				}
+				if ambiguous {
+					reportAmbiguous(log, em.GetAllRulesByLog(log))
+					continue
+				}
 				if em.GetLogEventID(log) == 0 {
-					xs := em.GuessLogEventID(log, 1)
-					rs := em.GetRulesByEventID(xs[0])
+					r := event.Rule{Name: log.Message}
+					// the catalog may be empty, eg. of TiFlash
+					if xs := em.GuessLogEventID(log, 1); len(xs) > 0 {
+						r.ID, r.Name = xs[0], em.GetRulesByEventID(xs[0])[0].Name
+					}
 					fs := []string{}
 					for _, f := range log.Fields {
 						fs = append(fs, f.Name)
 					}
-					r := event.Rule{
-						ID:   xs[0],
-						Name: rs[0].Name,
-						Patterns: event.RulePattern{
-							Level:   string(log.Header.Level),
-							Message: log.Message,
-							Fields:  fs,
-						},
+					r.Patterns = event.RulePattern{
+						Level:   string(log.Header.Level),
+						Message: log.Message,
+						Fields:  fs,
+					}
+					if log.Position != nil {
+						fmt.Printf("# %s\n", log.Position)
 					}
 					err = toml.NewEncoder(os.Stdout).Encode(struct {
 						Rule []event.Rule `toml:"rule"`
@@ -83,9 +97,31 @@ func newCheckCommand() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVarP(&withoutTime, "without-time", "", false, "if every line doesn't contains the time header")
+	cmd.Flags().BoolVarP(&ambiguous, "ambiguous", "", false, "report the logs matched by the rules of more than one event instead")
+	input.addFlags(cmd)
+	component.addFlags(cmd)
 	return cmd
 }
 
+// reportAmbiguous prints the log if the rules are of more than one event.
+func reportAmbiguous(log *parser.LogEntry, rules []*event.Rule) {
+	ids := map[uint]bool{}
+	xs := []string{}
+	for _, r := range rules {
+		if !ids[r.ID] {
+			ids[r.ID] = true
+			xs = append(xs, fmt.Sprintf("%d (%s)", r.ID, r.Name))
+		}
+	}
+	if len(ids) < 2 {
+		return
+	}
+	if log.Position != nil {
+		fmt.Printf("%s: ", log.Position)
+	}
+	fmt.Printf("%s: matched by %s\n", log.Message, strings.Join(xs, ", "))
+}
+
 func assert(err error) {
 	if err != nil {
 		panic(err)
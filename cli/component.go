@@ -0,0 +1,138 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/event"
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/spf13/cobra"
+)
+
+// detectSampleSize is the max number of logs read ahead to detect the
+// component.
+const detectSampleSize = 1000
+
+// componentFlag is the component of the logs given by the flags, it's
+// detected from the logs if not given.
+type componentFlag struct {
+	name string
+	tp   event.ComponentType
+	// rules are the files and directories of the custom rules
+	rules []string
+}
+
+// logReader reads the logs one by one like *parser.StreamParser.
+type logReader interface {
+	Next() (*parser.LogEntry, error)
+}
+
+// isParseError tells if the error is a malformed line, which is skipped,
+// rather than an error of reading the logs.
+func isParseError(err error) bool {
+	_, ok := err.(*parser.ParseError)
+	return ok
+}
+
+// replayReader returns the logs read ahead before the following ones.
+type replayReader struct {
+	logs []*parser.LogEntry
+	errs []error
+	next logReader
+}
+
+func (r *replayReader) Next() (*parser.LogEntry, error) {
+	if len(r.logs) == 0 {
+		return r.next.Next()
+	}
+	log, err := r.logs[0], r.errs[0]
+	r.logs, r.errs = r.logs[1:], r.errs[1:]
+	return log, err
+}
+
+// eventManager creates the *event.EventManager with the rules of the
+// component, scoped to the version in the startup banners of the logs. If
+// the component is not given, it's detected by the logs read ahead from p
+// until the detector is confident, so the logs should be read from the
+// returned logReader instead of p.
+func (c *componentFlag) eventManager(p *parser.StreamParser) (*event.VersionScope, logReader, error) {
+	var logs logReader = p
+	if c.name != "" {
+		tp, err := event.GetComponentType(c.name)
+		if err != nil {
+			return nil, nil, err
+		}
+		c.tp = tp
+	} else {
+		logs = c.detect(p)
+	}
+	sources := []event.RuleSource{}
+	for _, path := range c.rules {
+		source, err := event.RulePath(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, source)
+	}
+	em, err := event.NewEventManagerWithSources([]event.ComponentType{c.tp}, sources...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return event.NewVersionScope(em), logs, nil
+}
+
+// detect detects the component by the logs read ahead from p, it falls back
+// to event.DefaultComponent if nothing is detected.
+func (c *componentFlag) detect(p *parser.StreamParser) logReader {
+	d := event.NewDetector()
+	r := &replayReader{next: p}
+	for len(r.logs) < detectSampleSize && !d.Confident() {
+		log, err := p.Next()
+		if log == nil && err == nil {
+			break
+		}
+		r.logs = append(r.logs, log)
+		r.errs = append(r.errs, err)
+		if log != nil {
+			d.Observe(log)
+		}
+	}
+	tp, ok := d.ComponentOrDefault()
+	if ok {
+		fmt.Fprintf(os.Stderr, "detected component: %s\n", tp)
+	} else {
+		fmt.Fprintf(os.Stderr, "can't detect the component of the logs, use %s, specify it by --component otherwise\n", tp)
+	}
+	c.tp = tp
+	return r
+}
+
+// table returns the table of the component in the storage, it must be
+// called after eventManager.
+func (c *componentFlag) table() string {
+	return strings.ReplaceAll(c.tp.String(), "-", "_")
+}
+
+func (c *componentFlag) addFlags(cmd *cobra.Command) {
+	names := []string{}
+	for _, tp := range event.AllComponentTypes() {
+		names = append(names, tp.String())
+	}
+	cmd.Flags().StringVarP(&c.name, "component", "c", "", "the component of the logs, one of "+strings.Join(names, ", ")+", detected from the logs by default and tidb if it can't be detected")
+	cmd.Flags().StringSliceVarP(&c.rules, "rules", "", nil, "the rule files or directories of *.toml extending the embedded rules, the later ones take precedence")
+}
@@ -21,8 +21,6 @@ import (
 	"path"
 	"sort"
 
-	"github.com/lucklove/tidb-log-parser/event"
-	"github.com/lucklove/tidb-log-parser/parser"
 	"github.com/lucklove/tidb-log-parser/store"
 	"github.com/spf13/cobra"
 )
@@ -54,26 +52,37 @@ func (d *BatchDiager) Count(id uint) uint {
 }
 
 func newDiagCommand() *cobra.Command {
+	input := logInput{}
+	component := componentFlag{}
+	metadata := false
 	cmd := &cobra.Command{
 		Use: "diag",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			d := BatchDiager{make(map[uint]uint), 0}
 
+			p, err := input.open()
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			em, logs, err := component.eventManager(p)
+			if err != nil {
+				return err
+			}
 			home, err := os.UserHomeDir()
 			assert(err)
-			store, err := store.NewSQLiteStorage(path.Join(home, ".tiup/storage/naglfar/log.db"), "tidb")
+			store, err := store.NewSQLiteStorage(path.Join(home, ".tiup/storage/naglfar/log.db"), component.table())
 			assert(err)
 			defer store.Close()
 
-			p := parser.NewStreamParser(os.Stdin)
-			em, err := event.NewEventManager(event.ComponentTiDB)
-			assert(err)
-
 			for {
-				log, err := p.Next()
+				log, err := logs.Next()
 				if log == nil && err == nil {
 					break
 				}
+				if err != nil && !isParseError(err) {
+					return err
+				}
 				if log == nil || err != nil {
 					continue
 				}
@@ -82,6 +91,9 @@ func newDiagCommand() *cobra.Command {
 				}
 				eid := em.GetLogEventID(log)
 				if eid == 0 {
+					if log.Position != nil {
+						fmt.Printf("%s: ", log.Position)
+					}
 					fmt.Println(log.Message)
 					panic("eid should not be zero, please run check command first")
 				}
@@ -106,12 +118,20 @@ func newDiagCommand() *cobra.Command {
 				rs := em.GetRulesByEventID(eid)
 				ec, err := store.EventCount(eid)
 				assert(err)
-				fmt.Printf("%f\t%d\t%d\t%d\t%s\n", wm[eid], d.Count(eid), ec, lfc, rs[0].Name)
+				if !metadata {
+					fmt.Printf("%f\t%d\t%d\t%d\t%s\n", wm[eid], d.Count(eid), ec, lfc, rs[0].Name)
+					continue
+				}
+				fmt.Printf("%f\t%d\t%d\t%d\t%s\t%s\t%s\n", wm[eid], d.Count(eid), ec, lfc, rs[0].Name, orDash(rs[0].Severity), orDash(rs[0].Category))
+				printMetadataDetails(rs[0])
 			}
 
 			return nil
 		},
 	}
 
+	input.addFlags(cmd)
+	component.addFlags(cmd)
+	cmd.Flags().BoolVar(&metadata, "metadata", false, "print the severity and category of the events, and the description, remediation and links under them")
 	return cmd
 }
@@ -1,42 +1,82 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"encoding/csv"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
 
-	"github.com/lucklove/tidb-log-parser/event"
 	"github.com/lucklove/tidb-log-parser/parser"
 	"github.com/spf13/cobra"
 )
 
 func newExportCommand() *cobra.Command {
+	input := logInput{}
+	component := componentFlag{}
+	follow := false
+	metadata := false
 	cmd := &cobra.Command{
 		Use: "export",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			p := parser.NewStreamParser(os.Stdin)
-			em, err := event.NewEventManager(event.ComponentTiDB)
-			assert(err)
+			var p *parser.StreamParser
+			var err error
+			if follow {
+				ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+				defer cancel()
+				p, err = input.follow(ctx)
+			} else {
+				p, err = input.open()
+			}
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			em, logs, err := component.eventManager(p)
+			if err != nil {
+				return err
+			}
 
+			w := csv.NewWriter(os.Stdout)
 			for {
-				log, err := p.Next()
+				log, err := logs.Next()
 				if log == nil && err == nil {
 					break
 				}
+				if err != nil && !isParseError(err) {
+					return err
+				}
 				if log == nil || err != nil {
 					continue
 				}
 				if ignore(log) {
 					continue
 				}
-				eid := em.GetLogEventID(log)
-				if eid == 0 {
+				rule := em.GetRuleByLog(log)
+				if rule == nil {
 					continue
 				}
-				fmt.Printf("%d,%d\n", log.Header.DateTime.Unix(), eid)
+				record := []string{strconv.FormatInt(log.Header.DateTime.Unix(), 10), strconv.FormatUint(uint64(rule.ID), 10)}
+				if metadata {
+					record = append(record, metadataColumns(rule)...)
+				}
+				if err := w.Write(record); err != nil {
+					return err
+				}
+				// flushed by line for --follow
+				w.Flush()
+				if err := w.Error(); err != nil {
+					return err
+				}
 			}
 			return nil
 		},
 	}
 
+	input.addFlags(cmd)
+	component.addFlags(cmd)
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep reading the --input file as it grows, like tail -F")
+	cmd.Flags().BoolVar(&metadata, "metadata", false, "append the severity, category and tags (separated by ';') of the events")
 	return cmd
 }
@@ -0,0 +1,68 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/spf13/cobra"
+)
+
+// logInput is the input of logs given by the flags.
+type logInput struct {
+	path      string
+	container bool
+}
+
+// open opens the logs to parse, they're read from stdin if the path is empty,
+// otherwise the path is a directory or a glob of (compressed and rotated) log
+// files.
+func (in *logInput) open() (*parser.StreamParser, error) {
+	if in.path == "" {
+		return in.config(parser.NewStreamParser(os.Stdin).WithSource("<stdin>")), nil
+	}
+	p, err := parser.OpenLogSet(in.path)
+	if err != nil {
+		return nil, err
+	}
+	return in.config(p), nil
+}
+
+// follow follows the log file like `tail -F` until ctx is done.
+func (in *logInput) follow(ctx context.Context) (*parser.StreamParser, error) {
+	if in.path == "" {
+		return nil, errors.New("--follow requires a log file given by --input")
+	}
+	p, err := parser.FollowFile(ctx, in.path, parser.FollowOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return in.config(p), nil
+}
+
+func (in *logInput) config(p *parser.StreamParser) *parser.StreamParser {
+	if in.container {
+		p = p.WithContainer()
+	}
+	return p.WithMultiline(0)
+}
+
+func (in *logInput) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&in.path, "input", "i", "", "the directory or glob of log files to read instead of stdin")
+	cmd.Flags().BoolVarP(&in.container, "container", "", false, "unwrap the logs of CRI, Docker json-file and kubectl logs --prefix")
+}
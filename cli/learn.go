@@ -19,34 +19,42 @@ import (
 	"os"
 	"path"
 
-	"github.com/lucklove/tidb-log-parser/event"
-	"github.com/lucklove/tidb-log-parser/parser"
 	"github.com/lucklove/tidb-log-parser/store"
 	"github.com/spf13/cobra"
 )
 
 func newLearnCommand() *cobra.Command {
+	input := logInput{}
+	component := componentFlag{}
 	cmd := &cobra.Command{
 		Use: "learn",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := input.open()
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			em, logs, err := component.eventManager(p)
+			if err != nil {
+				return err
+			}
 			home, err := os.UserHomeDir()
 			assert(err)
-			store, err := store.NewSQLiteStorage(path.Join(home, ".tiup/storage/naglfar/log.db"), "tidb")
+			store, err := store.NewSQLiteStorage(path.Join(home, ".tiup/storage/naglfar/log.db"), component.table())
 			assert(err)
 			defer store.Close()
 			fc, err := store.LogFragmentCount()
 			assert(err)
 			fid := fc + 1
 
-			p := parser.NewStreamParser(os.Stdin)
-			em, err := event.NewEventManager(event.ComponentTiDB)
-			assert(err)
-
 			for {
-				log, err := p.Next()
+				log, err := logs.Next()
 				if log == nil && err == nil {
 					break
 				}
+				if err != nil && !isParseError(err) {
+					return err
+				}
 				if log == nil || err != nil {
 					continue
 				}
@@ -64,5 +72,7 @@ func newLearnCommand() *cobra.Command {
 		},
 	}
 
+	input.addFlags(cmd)
+	component.addFlags(cmd)
 	return cmd
 }
@@ -0,0 +1,67 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lucklove/tidb-log-parser/event"
+	"github.com/spf13/cobra"
+)
+
+func newLintRulesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint-rules [file or directory]...",
+		Short: "Check the rule catalogs, the embedded ones if no file is given",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			problems := []*event.LintProblem{}
+			if len(args) == 0 {
+				ps, err := event.LintEmbedded()
+				if err != nil {
+					return err
+				}
+				problems = append(problems, ps...)
+			}
+			for _, arg := range args {
+				paths := []string{arg}
+				if st, err := os.Stat(arg); err == nil && st.IsDir() {
+					if paths, err = filepath.Glob(filepath.Join(arg, "*.toml")); err != nil {
+						return err
+					}
+					sort.Strings(paths)
+				}
+				for _, path := range paths {
+					ps, err := event.LintFile(path)
+					if err != nil {
+						return err
+					}
+					problems = append(problems, ps...)
+				}
+			}
+
+			for _, p := range problems {
+				fmt.Println(p)
+			}
+			if len(problems) > 0 {
+				return fmt.Errorf("%d problems found", len(problems))
+			}
+			return nil
+		},
+	}
+	return cmd
+}
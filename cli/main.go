@@ -15,11 +15,15 @@
 package main
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
 func main() {
-	command().Execute()
+	if err := command().Execute(); err != nil {
+		os.Exit(1)
+	}
 }
 
 func command() *cobra.Command {
@@ -36,6 +40,9 @@ func command() *cobra.Command {
 		newLearnCommand(),
 		newDiagCommand(),
 		newExportCommand(),
+		newSlowLogCommand(),
+		newSessionsCommand(),
+		newLintRulesCommand(),
 	)
 
 	return cmd
@@ -0,0 +1,50 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/event"
+)
+
+// orDash returns "-" for an empty value to keep the columns.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// printMetadataDetails prints the description, remediation and links of
+// the rule as indented lines under the line of the event.
+func printMetadataDetails(r *event.Rule) {
+	if r.Description != "" {
+		fmt.Printf("\tdescription: %s\n", r.Description)
+	}
+	if r.Remediation != "" {
+		fmt.Printf("\tremediation: %s\n", r.Remediation)
+	}
+	for _, link := range r.Links {
+		fmt.Printf("\tlink: %s\n", link)
+	}
+}
+
+// metadataColumns returns the severity, category and tags of the rule as
+// the columns of CSV, the tags are separated by ';'.
+func metadataColumns(r *event.Rule) []string {
+	return []string{r.Severity, r.Category, strings.Join(r.Tags, ";")}
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/lucklove/tidb-log-parser/sqllog"
+	"github.com/spf13/cobra"
+)
+
+func newSessionsCommand() *cobra.Command {
+	input := logInput{}
+	conn := uint64(0)
+	cmd := &cobra.Command{
+		Use:   "sessions",
+		Short: "Reconstruct the SQL history of every connection from the general log or the audit log of TiDB",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := input.open()
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+
+			tracker := sqllog.NewSessionTracker()
+			for {
+				log, err := p.Next()
+				if log == nil && err == nil {
+					break
+				}
+				if err != nil && !isParseError(err) {
+					return err
+				}
+				if log == nil || err != nil {
+					continue
+				}
+				if log.Message == "Welcome to TiDB." {
+					// the connection IDs are counted from the start again
+					tracker.Restart()
+					continue
+				}
+				a, err := sqllog.Decode(log)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %s\n", log.Position, err)
+					continue
+				}
+				if a == nil || (conn != 0 && a.ConnID != conn) {
+					continue
+				}
+				tracker.Add(a)
+			}
+
+			for _, s := range tracker.Sessions() {
+				user := s.User
+				if s.Host != "" {
+					user += "@" + s.Host
+				}
+				fmt.Printf("# conn %d %s from %s to %s, %d statements\n", s.ConnID, user,
+					s.Start.Format(parser.TiDBTimeFormat), s.End.Format(parser.TiDBTimeFormat), len(s.Activities))
+				for _, a := range s.Activities {
+					fmt.Printf("%s\t%s\t%s\n", a.Time.Format(parser.TiDBTimeFormat), a.DB, strings.Join(strings.Fields(a.SQL), " "))
+				}
+				fmt.Println()
+			}
+			return nil
+		},
+	}
+
+	input.addFlags(cmd)
+	cmd.Flags().Uint64VarP(&conn, "conn", "", 0, "only show the session of the connection ID")
+	return cmd
+}
@@ -0,0 +1,99 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/lucklove/tidb-log-parser/slowlog"
+	"github.com/spf13/cobra"
+)
+
+func newSlowLogCommand() *cobra.Command {
+	input := ""
+	top := 10
+	by := string(slowlog.SortByTotal)
+	cmd := &cobra.Command{
+		Use:   "slowlog",
+		Short: "Summarize the top digests of the TiDB slow query log",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := slowlog.ParseSortKey(by)
+			if err != nil {
+				return err
+			}
+			s := slowlog.NewSummarizer()
+			summarize := func(p *slowlog.Parser) error {
+				for {
+					r, err := p.Next()
+					if _, ok := err.(*slowlog.RecordError); ok {
+						fmt.Fprintln(os.Stderr, err)
+						continue
+					}
+					if err != nil {
+						return err
+					}
+					if r == nil {
+						return nil
+					}
+					s.Add(r)
+				}
+			}
+
+			if input == "" {
+				if err := summarize(slowlog.NewParser(os.Stdin)); err != nil {
+					return err
+				}
+			} else {
+				paths, err := parser.ListSlowLogFiles(input)
+				if err != nil {
+					return err
+				}
+				for _, path := range paths {
+					f, err := parser.OpenLogFile(path)
+					if err != nil {
+						return err
+					}
+					err = summarize(slowlog.NewParser(f).WithSource(path))
+					f.Close()
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			digests, err := s.Top(top, key)
+			if err != nil {
+				return err
+			}
+			fmt.Println("count\ttotal\tavg\tmax\tdigest\tsql")
+			for _, d := range digests {
+				sql := strings.Join(strings.Fields(d.SQL), " ")
+				if runes := []rune(sql); len(runes) > 100 {
+					sql = string(runes[:100]) + "..."
+				}
+				fmt.Printf("%d\t%s\t%s\t%s\t%s\t%s\n", d.Count, d.Total, d.Avg(), d.Max, d.Digest, sql)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&input, "input", "i", "", "the directory or glob of slow log files to read instead of stdin")
+	cmd.Flags().IntVarP(&top, "top", "n", top, "the number of digests to show, all if it's not positive")
+	cmd.Flags().StringVarP(&by, "by", "", by, "order the digests by total, avg, max or count of the query time")
+	return cmd
+}
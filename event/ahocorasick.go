@@ -0,0 +1,106 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+// acAutomaton is an Aho-Corasick automaton finding all the patterns in a
+// text in one pass, the cost is linear to the length of the text and the
+// number of matches whatever the number of patterns.
+type acAutomaton struct {
+	nodes []acNode
+}
+
+type acNode struct {
+	next map[byte]int32
+	fail int32
+	// dict is the nearest node on the fail chain with patterns, -1 if none
+	dict int32
+	// patterns are the indexes of the patterns ending at the node
+	patterns []int
+}
+
+func newACAutomaton(patterns []string) *acAutomaton {
+	ac := &acAutomaton{nodes: []acNode{{dict: -1}}}
+	for i, p := range patterns {
+		cur := int32(0)
+		for j := 0; j < len(p); j++ {
+			next, ok := ac.nodes[cur].next[p[j]]
+			if !ok {
+				next = int32(len(ac.nodes))
+				ac.nodes = append(ac.nodes, acNode{dict: -1})
+				if ac.nodes[cur].next == nil {
+					ac.nodes[cur].next = make(map[byte]int32)
+				}
+				ac.nodes[cur].next[p[j]] = next
+			}
+			cur = next
+		}
+		ac.nodes[cur].patterns = append(ac.nodes[cur].patterns, i)
+	}
+
+	// breadth first, so the fail node is done before the node
+	queue := []int32{}
+	for _, child := range ac.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for b, child := range ac.nodes[cur].next {
+			queue = append(queue, child)
+			fail := ac.nodes[cur].fail
+			for {
+				if next, ok := ac.nodes[fail].next[b]; ok {
+					ac.nodes[child].fail = next
+					break
+				}
+				if fail == 0 {
+					ac.nodes[child].fail = 0
+					break
+				}
+				fail = ac.nodes[fail].fail
+			}
+			f := ac.nodes[child].fail
+			if len(ac.nodes[f].patterns) > 0 {
+				ac.nodes[child].dict = f
+			} else {
+				ac.nodes[child].dict = ac.nodes[f].dict
+			}
+		}
+	}
+	return ac
+}
+
+// find calls fn with the index of every pattern in the text, a pattern is
+// reported once for every occurrence.
+func (ac *acAutomaton) find(text string, fn func(pattern int)) {
+	cur := int32(0)
+	for i := 0; i < len(text); i++ {
+		for {
+			if next, ok := ac.nodes[cur].next[text[i]]; ok {
+				cur = next
+				break
+			}
+			if cur == 0 {
+				break
+			}
+			cur = ac.nodes[cur].fail
+		}
+		for n := cur; n > 0; n = ac.nodes[n].dict {
+			for _, p := range ac.nodes[n].patterns {
+				fn(p)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/pingcap/errors"
+)
+
+// The operators of FieldCondition.
+const (
+	ConditionEqual        = "eq"
+	ConditionNotEqual     = "ne"
+	ConditionRegex        = "regex"
+	ConditionLess         = "lt"
+	ConditionLessEqual    = "le"
+	ConditionGreater      = "gt"
+	ConditionGreaterEqual = "ge"
+	ConditionPresent      = "present"
+	ConditionAbsent       = "absent"
+)
+
+// FieldCondition constrains the value of a field of the log, eg.
+//
+//	[[rule.patterns.conditions]]
+//	  field = "type"
+//	  op = "eq"
+//	  value = "regionMiss"
+//
+// The field must be present unless the op is absent. The value of eq, ne and
+// regex is compared as a string, the one of lt, le, gt and ge as a number, a
+// duration like "1.5s" or a byte size like "1GiB", and a field not a number
+// doesn't match them.
+type FieldCondition struct {
+	Field string `toml:"field"`
+	Op    string `toml:"op"`
+	Value string `toml:"value,omitempty"`
+}
+
+// compiledCondition is the FieldCondition ready to evaluate.
+type compiledCondition struct {
+	*FieldCondition
+	regex  *regexp.Regexp
+	number float64
+}
+
+func compileCondition(c *FieldCondition) (*compiledCondition, error) {
+	cc := &compiledCondition{FieldCondition: c}
+	if c.Field == "" {
+		return nil, errors.New("field of condition is empty")
+	}
+	switch c.Op {
+	case ConditionEqual, ConditionNotEqual, ConditionPresent, ConditionAbsent:
+	case ConditionRegex:
+		regex, err := regexp.Compile(c.Value)
+		if err != nil {
+			return nil, errors.Annotatef(err, "condition on %s", c.Field)
+		}
+		cc.regex = regex
+	case ConditionLess, ConditionLessEqual, ConditionGreater, ConditionGreaterEqual:
+		number, ok := parseNumber(c.Value)
+		if !ok {
+			return nil, errors.Errorf("condition on %s: '%s' is not a number", c.Field, c.Value)
+		}
+		cc.number = number
+	default:
+		return nil, errors.Errorf("condition on %s: unknown op '%s'", c.Field, c.Op)
+	}
+	return cc, nil
+}
+
+// match tells if the value of the field satisfies the condition, ok is false
+// if the field is absent.
+func (c *compiledCondition) match(value string, ok bool) bool {
+	if c.Op == ConditionAbsent {
+		return !ok
+	}
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case ConditionEqual:
+		return value == c.Value
+	case ConditionNotEqual:
+		return value != c.Value
+	case ConditionRegex:
+		return c.regex.MatchString(value)
+	case ConditionPresent:
+		return true
+	}
+	number, ok := parseNumber(value)
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case ConditionLess:
+		return number < c.number
+	case ConditionLessEqual:
+		return number <= c.number
+	case ConditionGreater:
+		return number > c.number
+	default:
+		return number >= c.number
+	}
+}
+
+// parseNumber parses a number, a duration in seconds or a byte size like
+// 1.2GiB in bytes.
+func parseNumber(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), true
+	}
+	if size, err := parser.ParseByteSize(s); err == nil {
+		return float64(size), true
+	}
+	return 0, false
+}
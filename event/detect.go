@@ -0,0 +1,221 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+)
+
+// The weights of the evidences of a component.
+const (
+	bannerWeight = 100
+	nameWeight   = 10
+	fileWeight   = 1
+	ruleWeight   = 1
+)
+
+// banners are the messages printed by the components on startup.
+var banners = map[string]ComponentType{
+	"welcome to tidb.":                     ComponentTiDB,
+	"welcome to tikv":                      ComponentTiKV,
+	"welcome to placement driver (pd)":     ComponentPD,
+	"welcome to tidb-lightning":            ComponentLightning,
+	"welcome to tiflash":                   ComponentTiFlash,
+	"welcome to dm-master":                 ComponentDM,
+	"welcome to dm-worker":                 ComponentDM,
+	"welcome to change data capture (cdc)": ComponentTiCDC,
+	"welcome to backup & restore (br)":     ComponentBR,
+	"welcome to dumpling":                  ComponentDumpling,
+}
+
+// sourceExts are the extensions of the source files in the log headers
+// telling the language, and so the component.
+var sourceExts = map[string]ComponentType{
+	".rs":  ComponentTiKV,
+	".cpp": ComponentTiFlash,
+	".h":   ComponentTiFlash,
+}
+
+var detectManagers struct {
+	once sync.Once
+	ems  map[ComponentType]*EventManager
+}
+
+// Detector infers the component of logs from the evidences below, in the
+// order of weight:
+//
+//	the startup banner, eg. "Welcome to TiDB."
+//	the file name and the container name, eg. tikv.log and basic-pd-0
+//	the language of the source files in the headers, eg. *.rs of TiKV
+//	the number of logs matched by the rules of every component
+type Detector struct {
+	scores map[ComponentType]float64
+	names  map[string]bool
+	banner bool
+	ems    map[ComponentType]*EventManager
+}
+
+// NewDetector creates a *Detector without evidence.
+func NewDetector() *Detector {
+	detectManagers.once.Do(func() {
+		detectManagers.ems = make(map[ComponentType]*EventManager)
+		for _, tp := range AllComponentTypes() {
+			// the embedded rules are tested to be valid
+			if em, err := NewEventManager(tp); err == nil {
+				detectManagers.ems[tp] = em
+			}
+		}
+	})
+	return &Detector{
+		scores: make(map[ComponentType]float64),
+		names:  make(map[string]bool),
+		ems:    detectManagers.ems,
+	}
+}
+
+// Observe collects the evidences of the log.
+func (d *Detector) Observe(l *parser.LogEntry) {
+	if l.Position != nil {
+		d.ObserveName(l.Position.Source)
+	}
+	if l.Container != nil {
+		d.ObserveName(l.Container.Container)
+	}
+	msg := strings.ToLower(l.Message)
+	for banner, tp := range banners {
+		if strings.HasPrefix(msg, banner) {
+			d.scores[tp] += bannerWeight
+			d.banner = true
+		}
+	}
+	if tp, ok := sourceExts[filepath.Ext(l.Header.File)]; ok {
+		d.scores[tp] += fileWeight
+	}
+	matched := []ComponentType{}
+	for tp, em := range d.ems {
+		if em.GetRuleByLog(l) != nil {
+			matched = append(matched, tp)
+		}
+	}
+	for _, tp := range matched {
+		d.scores[tp] += ruleWeight / float64(len(matched))
+	}
+}
+
+// ObserveName collects the evidence of a file name or a container name,
+// every name counts once.
+func (d *Detector) ObserveName(name string) {
+	if name == "" || d.names[name] {
+		return
+	}
+	d.names[name] = true
+	if tp, ok := componentFromName(name); ok {
+		d.scores[tp] += nameWeight
+	}
+}
+
+// Confident tells if the evidences are strong enough that more logs are
+// unlikely to change the result, ie. a banner or a name is seen.
+func (d *Detector) Confident() bool {
+	if d.banner {
+		return true
+	}
+	for _, score := range d.scores {
+		if score >= nameWeight {
+			return true
+		}
+	}
+	return false
+}
+
+// Component returns the most likely component, it returns false if there
+// is no evidence at all.
+func (d *Detector) Component() (ComponentType, bool) {
+	best, found := ComponentType(0), false
+	for _, tp := range AllComponentTypes() {
+		if d.scores[tp] > 0 && (!found || d.scores[tp] > d.scores[best]) {
+			best, found = tp, true
+		}
+	}
+	return best, found
+}
+
+// DefaultComponent is the component of the logs without any evidence.
+const DefaultComponent = ComponentTiDB
+
+// ComponentOrDefault returns the most likely component like Component, or
+// DefaultComponent with detected false if there is no evidence at all.
+func (d *Detector) ComponentOrDefault() (tp ComponentType, detected bool) {
+	if tp, ok := d.Component(); ok {
+		return tp, true
+	}
+	return DefaultComponent, false
+}
+
+// DetectComponent infers the component of the logs with a Detector.
+func DetectComponent(logs []*parser.LogEntry) (ComponentType, bool) {
+	d := NewDetector()
+	for _, l := range logs {
+		d.Observe(l)
+	}
+	return d.Component()
+}
+
+// DetectComponentOrDefault infers the component of the logs like
+// DetectComponent, or returns DefaultComponent with detected false if
+// there is no evidence at all.
+func DetectComponentOrDefault(logs []*parser.LogEntry) (tp ComponentType, detected bool) {
+	d := NewDetector()
+	for _, l := range logs {
+		d.Observe(l)
+	}
+	return d.ComponentOrDefault()
+}
+
+// componentFromName finds the name of a component in the words of a file
+// name or a container name, eg. tidb-lightning.log and basic-tikv-0. The
+// longer names are tried first so that tidb-operator isn't taken as tidb.
+func componentFromName(name string) (ComponentType, bool) {
+	words := strings.FieldsFunc(strings.ToLower(filepath.Base(name)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	normalized := "-" + strings.Join(words, "-") + "-"
+
+	type candidate struct {
+		name string
+		tp   ComponentType
+	}
+	candidates := []candidate{}
+	for _, tp := range AllComponentTypes() {
+		for _, n := range componentNames[tp] {
+			candidates = append(candidates, candidate{n, tp})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return len(candidates[i].name) > len(candidates[j].name)
+	})
+	for _, c := range candidates {
+		if strings.Contains(normalized, "-"+c.name+"-") {
+			return c.tp, true
+		}
+	}
+	return ComponentType(0), false
+}
@@ -0,0 +1,91 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"testing"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectComponent(t *testing.T) {
+	parse := func(s string) []*parser.LogEntry {
+		logs, err := parser.ParseFromString(s)
+		assert.Nil(t, err)
+		return logs
+	}
+
+	// banner
+	tp, ok := DetectComponent(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [printer.go:34] ["Welcome to TiDB."] ["Release Version"=v5.3.0]`))
+	assert.True(t, ok)
+	assert.Equal(t, ComponentTiDB, tp)
+	tp, ok = DetectComponent(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [util.go:41] ["Welcome to Placement Driver (PD)"]`))
+	assert.True(t, ok)
+	assert.Equal(t, ComponentPD, tp)
+
+	// source file of rust
+	tp, ok = DetectComponent(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [mod.rs:1] ["something unknown"]`))
+	assert.True(t, ok)
+	assert.Equal(t, ComponentTiKV, tp)
+
+	// rules
+	tp, ok = DetectComponent(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["send schedule command"] [region-id=1] [step=x] [source=y]`))
+	assert.True(t, ok)
+	assert.Equal(t, ComponentPD, tp)
+
+	_, ok = DetectComponent(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["something unknown"]`))
+	assert.False(t, ok)
+	tp, ok = DetectComponentOrDefault(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["something unknown"]`))
+	assert.False(t, ok)
+	assert.Equal(t, DefaultComponent, tp)
+	// all the logs are evidences
+	tp, ok = DetectComponentOrDefault(parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["something unknown"]
+[2021/12/13 20:41:00.755 +08:00] [INFO] [util.go:41] ["Welcome to Placement Driver (PD)"]`))
+	assert.True(t, ok)
+	assert.Equal(t, ComponentPD, tp)
+
+	// the name outweighs the rules
+	d := NewDetector()
+	for _, l := range parse(`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["send schedule command"] [region-id=1] [step=x] [source=y]`) {
+		d.Observe(l)
+	}
+	assert.False(t, d.Confident())
+	d.ObserveName("/var/log/ticdc/basic-ticdc-0.log")
+	assert.True(t, d.Confident())
+	tp, _ = d.Component()
+	assert.Equal(t, ComponentTiCDC, tp)
+}
+
+func TestComponentFromName(t *testing.T) {
+	for name, expected := range map[string]ComponentType{
+		"/var/log/tidb.log":                    ComponentTiDB,
+		"tidb-2021-12-13T20-41-00.000.log.gz":  ComponentTiDB,
+		"tidb-lightning.log":                   ComponentLightning,
+		"basic-tikv-0":                         ComponentTiKV,
+		"pd_stderr.log":                        ComponentPD,
+		"dm-worker.log":                        ComponentDM,
+		"tidb-operator-controller-manager-abc": ComponentOperator,
+		"cdc.log":                              ComponentTiCDC,
+	} {
+		tp, ok := componentFromName(name)
+		assert.True(t, ok, name)
+		assert.Equal(t, expected, tp, name)
+	}
+	_, ok := componentFromName("server.log")
+	assert.False(t, ok)
+	_, ok = componentFromName("brain.log")
+	assert.False(t, ok)
+}
@@ -18,9 +18,9 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/lucklove/tidb-log-parser/parser"
-	"github.com/lucklove/tidb-log-parser/utils"
 )
 
 // EventManager is responsible for allocate event id for every LogEntry
@@ -31,30 +31,85 @@ type EventManager struct {
 	// the key is id of the rule
 	idRule map[uint][]*Rule
 
-	// regex map
+	// the key is the regex of the message, see messageRegex
 	msgRegex map[string]*regexp.Regexp
+
+	// the index of the rules for matching, see GetRuleByLog
+	matcher *matcher
+
+	// all the rules, their version ranges and the managers of the versions
+	// keyed by the rules applying to them, see ForVersion
+	rules      []*Rule
+	ranges     []versionRange
+	versionsMu sync.Mutex
+	versions   map[string]*EventManager
 }
 
 func NewEventManager(tps ...ComponentType) (*EventManager, error) {
-	rs, err := loadRule(tps...)
+	return NewEventManagerWithSources(tps)
+}
+
+// NewEventManagerWithSources creates the *EventManager with the embedded
+// rules of the components extended by the sources in order, the rules of a
+// source override the ones with the same ID of the embedded catalogs and
+// the sources before it. All the components are used if tps is empty.
+func NewEventManagerWithSources(tps []ComponentType, sources ...RuleSource) (*EventManager, error) {
+	rs, err := loadRule(tps, sources)
 	if err != nil {
 		return nil, err
 	}
-	msgRule := make(map[string][]*Rule)
-	idRule := make(map[uint][]*Rule)
-	msgRegex := make(map[string]*regexp.Regexp)
+	return newEventManager(rs)
+}
+
+func newEventManager(rs []*Rule) (*EventManager, error) {
+	em := &EventManager{
+		msgRule:  make(map[string][]*Rule),
+		idRule:   make(map[uint][]*Rule),
+		msgRegex: make(map[string]*regexp.Regexp),
+		rules:    rs,
+		versions: make(map[string]*EventManager),
+	}
+	// the rules in the order of matching, see sortRules, the rules of equal
+	// mode are grouped by message
+	exactRules := make(map[string][]*Rule)
+	regexRules, substrRules := []*Rule{}, []*Rule{}
 	for _, r := range rs {
-		if r.MessageMode() == MessageModeRegex {
-			regex, err := regexp.Compile(r.Patterns.Message)
+		vr, err := r.versionRange()
+		if err != nil {
+			return nil, err
+		}
+		em.ranges = append(em.ranges, vr)
+		switch r.MessageMode() {
+		case MessageModeRegex, MessageModeTemplate:
+			expr, _, err := r.messageRegex()
+			if err != nil {
+				return nil, err
+			}
+			regex, err := regexp.Compile(expr)
 			if err != nil {
 				return nil, err
 			}
-			msgRegex[r.Patterns.Message] = regex
+			em.msgRegex[expr] = regex
+			regexRules = append(regexRules, r)
+		case MessageModeSubstr:
+			substrRules = append(substrRules, r)
+		default:
+			exactRules[r.Patterns.Message] = append(exactRules[r.Patterns.Message], r)
 		}
-		msgRule[r.Patterns.Message] = append(msgRule[r.Patterns.Message], r)
-		idRule[r.ID] = append(idRule[r.ID], r)
+		em.msgRule[r.Patterns.Message] = append(em.msgRule[r.Patterns.Message], r)
+		em.idRule[r.ID] = append(em.idRule[r.ID], r)
+	}
+	for _, rules := range exactRules {
+		sortRules(rules)
 	}
-	return &EventManager{msgRule, idRule, msgRegex}, nil
+	sortRules(regexRules)
+	sortRules(substrRules)
+	m, err := newMatcher(exactRules, regexRules, substrRules, em.msgRegex)
+	if err != nil {
+		return nil, err
+	}
+	em.matcher = m
+	return em, nil
 }
 
 // GetRuleByID return rules with specified id
@@ -62,32 +117,55 @@ func (em *EventManager) GetRulesByEventID(id uint) []*Rule {
 	return em.idRule[id]
 }
 
-// GetRuleByLog returns the rule matched the log
+// GetRuleByLog returns the rule matched the log. The rules are tried in the
+// order of message mode (equal, regex or template and then substr), priority
+// (higher first), specificity (more fields, conditions and continuation
+// first) and the order they're loaded, so the result is deterministic.
 func (em *EventManager) GetRuleByLog(l *parser.LogEntry) *Rule {
-	if rs, ok := em.msgRule[l.Message]; ok {
-		if r := em.findMatchedRule(l, rs); r != nil {
-			return r
-		}
+	rs := em.matchRules(l, false)
+	if len(rs) == 0 {
+		return nil
 	}
+	return rs[0]
+}
 
-	rules := []*Rule{}
-	for msg := range em.msgRule {
-		if !strings.Contains(l.Message, msg) {
-			continue
-		}
-		for _, r := range em.msgRule[msg] {
-			if r.MessageMode() != MessageModeSubstr {
-				continue
-			}
-			rules = append(rules, r)
+// GetAllRulesByLog returns all the rules matched the log in the order they're
+// tried, a log matched by more than one event is ambiguous and the rules may
+// need a priority.
+func (em *EventManager) GetAllRulesByLog(l *parser.LogEntry) []*Rule {
+	return em.matchRules(l, true)
+}
+
+// Event is a log matched by a rule.
+type Event struct {
+	Rule *Rule
+	// Params are the fields of the log and the text captured from the
+	// message by the named groups of regex mode, eg. (?P<region_id>\d+), or
+	// the placeholders of template mode, eg. {region_id}. A capture takes
+	// precedence over the field of the same name.
+	Params map[string]string
+}
+
+// Match returns the event of the log matched by the rule GetRuleByLog
+// returns, it's nil if no rule matches.
+func (em *EventManager) Match(l *parser.LogEntry) *Event {
+	rs := em.matcher.match(l, false)
+	if len(rs) == 0 {
+		return nil
+	}
+	r := rs[0]
+	params := make(map[string]string, len(l.Fields))
+	for _, f := range l.Fields {
+		if _, ok := params[f.Name]; !ok {
+			params[f.Name] = f.Value
 		}
 	}
-
-	for msg := range em.msgRegex {
-		rules = append(rules, em.msgRule[msg]...)
+	if r.regex != nil {
+		for name, value := range captures(r.regex, l.Message) {
+			params[name] = value
+		}
 	}
-
-	return em.findMatchedRule(l, rules)
+	return &Event{Rule: r.Rule, Params: params}
 }
 
 // GetLogEventID scan the event conversion rules
@@ -112,7 +190,9 @@ func (em *EventManager) GuessLogEventID(l *parser.LogEntry, n int) []uint {
 	for msg := range em.msgRule {
 		msgs = append(msgs, msg)
 	}
-	sort.Sort(&stringSorter{l.Message, msgs})
+	// the messages as similar are kept in order to be deterministic
+	sort.Strings(msgs)
+	sort.Stable(&stringSorter{l.Message, msgs})
 
 LOOP_MSG:
 	for _, msg := range msgs {
@@ -122,8 +202,8 @@ LOOP_MSG:
 			k := getKeyFromRule(rule)
 			rs[k] = rule
 			ss = append(ss, k)
-			sort.Sort(&stringSorter{getKeyFromLog(l), ss})
 		}
+		sort.Stable(&stringSorter{getKeyFromLog(l), ss})
 		for _, s := range ss {
 			ids = append(ids, rs[s].ID)
 			if len(ids) == n {
@@ -135,34 +215,12 @@ LOOP_MSG:
 	return ids
 }
 
-func (em *EventManager) findMatchedRule(l *parser.LogEntry, rules []*Rule) *Rule {
-RULE_LOOP:
-	for _, r := range rules {
-		if r.MessageMode() == MessageModeRegex {
-			if !em.msgRegex[r.Patterns.Message].MatchString(l.Message) {
-				continue RULE_LOOP
-			}
-		} else if r.MessageMode() == MessageModeSubstr {
-			if !strings.Contains(l.Message, r.Patterns.Message) {
-				continue RULE_LOOP
-			}
-		} else if l.Message != r.Patterns.Message {
-			continue RULE_LOOP
-		}
-		if r.Patterns.Level != string(l.Header.Level) {
-			continue RULE_LOOP
-		}
-
-		fns := []string{}
-		for _, f := range l.Fields {
-			fns = append(fns, f.Name)
-		}
-		if len(utils.NewStringSet(r.Patterns.Fields...).Difference(utils.NewStringSet(fns...))) > 0 {
-			continue RULE_LOOP
-		}
-		return r
+func (em *EventManager) matchRules(l *parser.LogEntry, all bool) []*Rule {
+	rs := []*Rule{}
+	for _, r := range em.matcher.match(l, all) {
+		rs = append(rs, r.Rule)
 	}
-	return nil
+	return rs
 }
 
 func getKeyFromLog(l *parser.LogEntry) string {
@@ -15,6 +15,7 @@
 package event
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/lucklove/tidb-log-parser/parser"
@@ -79,3 +80,247 @@ func TestGussLogEventID(t *testing.T) {
 	assert.Equal(t, 1, len(ids))
 	assert.Equal(t, uint(10001), ids[0])
 }
+
+func TestContinuationPattern(t *testing.T) {
+	em, err := newEventManager([]*Rule{{
+		ID: 1,
+		Patterns: RulePattern{
+			Level:        "FATAL",
+			Message:      "panic",
+			Continuation: "index out of range",
+		},
+	}})
+	assert.Nil(t, err)
+	l := &parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelFatal},
+		Message: "panic",
+	}
+	assert.Equal(t, uint(0), em.GetLogEventID(l))
+	l.Continuation = []string{"panic: runtime error: index out of range [3] with length 3"}
+	assert.Equal(t, uint(1), em.GetLogEventID(l))
+}
+
+func TestFieldConditions(t *testing.T) {
+	source, err := RuleReader("conditions.toml", strings.NewReader(`
+[[rule]]
+  id = 1
+  name = "slow region miss"
+  [rule.patterns]
+    level = "WARN"
+    message = "backoffer.maxSleep is exceeded"
+    message_mode = "substr"
+    [[rule.patterns.conditions]]
+      field = "type"
+      op = "eq"
+      value = "regionMiss"
+    [[rule.patterns.conditions]]
+      field = "cost"
+      op = "ge"
+      value = "1s"
+
+[[rule]]
+  id = 2
+  name = "region miss"
+  [rule.patterns]
+    level = "WARN"
+    message = "backoffer.maxSleep is exceeded"
+    message_mode = "substr"
+    [[rule.patterns.conditions]]
+      field = "type"
+      op = "regex"
+      value = "^region"
+
+[[rule]]
+  id = 3
+  name = "other without store"
+  [rule.patterns]
+    level = "WARN"
+    message = "backoffer.maxSleep is exceeded"
+    message_mode = "substr"
+    [[rule.patterns.conditions]]
+      field = "type"
+      op = "ne"
+      value = "tikvRPC"
+    [[rule.patterns.conditions]]
+      field = "store"
+      op = "absent"
+`))
+	assert.Nil(t, err)
+	rs, err := source.LoadRules(ComponentTiDB)
+	assert.Nil(t, err)
+	em, err := newEventManager(rs)
+	assert.Nil(t, err)
+
+	log := func(fields ...string) *parser.LogEntry {
+		l := &parser.LogEntry{
+			Header:  parser.LogHeader{Level: parser.LogLevelWarn},
+			Message: "backoffer.maxSleep is exceeded",
+		}
+		for i := 0; i < len(fields); i += 2 {
+			l.Fields = append(l.Fields, parser.LogField{Name: fields[i], Value: fields[i+1]})
+		}
+		return l
+	}
+	assert.Equal(t, uint(1), em.GetLogEventID(log("type", "regionMiss", "cost", "1.5s")))
+	assert.Equal(t, uint(1), em.GetLogEventID(log("type", "regionMiss", "cost", "1")))
+	assert.Equal(t, uint(2), em.GetLogEventID(log("type", "regionMiss", "cost", "500ms", "store", "1")))
+	assert.Equal(t, uint(2), em.GetLogEventID(log("type", "regionScheduling", "cost", "unknown", "store", "1")))
+	// 3 is tried before 2 as more specific
+	assert.Equal(t, uint(3), em.GetLogEventID(log("type", "regionScheduling")))
+	assert.Equal(t, uint(3), em.GetLogEventID(log("type", "pdRPC")))
+	assert.Equal(t, uint(0), em.GetLogEventID(log("type", "pdRPC", "store", "1")))
+	assert.Equal(t, uint(0), em.GetLogEventID(log("type", "tikvRPC")))
+	assert.Equal(t, uint(0), em.GetLogEventID(log()))
+
+	// byte sizes
+	c, err := compileCondition(&FieldCondition{Field: "size", Op: ConditionGreater, Value: "1GiB"})
+	assert.Nil(t, err)
+	for value, expected := range map[string]bool{"1.2GiB": true, "2GB": true, "512MB": false, "1024": false} {
+		assert.Equal(t, expected, c.match(value, true), value)
+	}
+
+	for _, c := range []FieldCondition{
+		{Field: "x", Op: "like"},
+		{Field: "x", Op: ConditionRegex, Value: "("},
+		{Field: "x", Op: ConditionLess, Value: "a"},
+		{Op: ConditionPresent},
+	} {
+		c := c
+		_, err := newEventManager([]*Rule{{ID: 1, Patterns: RulePattern{Conditions: []*FieldCondition{&c}}}})
+		assert.NotNil(t, err, c)
+	}
+}
+
+func TestMatchOrder(t *testing.T) {
+	rule := func(id uint, mode, msg string, priority int, fields ...string) *Rule {
+		return &Rule{ID: id, Priority: priority, Patterns: RulePattern{
+			Level:       "INFO",
+			Message:     msg,
+			MessageMode: mode,
+			Fields:      fields,
+		}}
+	}
+	rules := []*Rule{
+		rule(1, "substr", "region", 0),
+		rule(2, "substr", "split", 0, "region-id"),
+		rule(3, "regex", "^split region \\d+$", 0, "region-id"),
+		rule(4, "regex", "split", 0),
+		rule(5, "", "split region 1", 0),
+		rule(6, "substr", "split", 1),
+	}
+	l := &parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelInfo},
+		Message: "split region 1",
+		Fields:  []parser.LogField{{Name: "region-id", Value: "1"}},
+	}
+	ids := func(rs []*Rule) []uint {
+		xs := []uint{}
+		for _, r := range rs {
+			xs = append(xs, r.ID)
+		}
+		return xs
+	}
+
+	for i := 0; i < 10; i++ {
+		em, err := newEventManager(rules)
+		assert.Nil(t, err)
+		assert.Equal(t, uint(5), em.GetLogEventID(l))
+		assert.Equal(t, []uint{5, 3, 4, 6, 2, 1}, ids(em.GetAllRulesByLog(l)))
+		// the order doesn't depend on the catalog
+		rules = append(rules[1:], rules[0])
+	}
+
+	// the rules as specific are tried in order
+	em, err := newEventManager([]*Rule{rule(1, "substr", "split", 0), rule(2, "substr", "region", 0)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{1, 2}, ids(em.GetAllRulesByLog(l)))
+	em, err = newEventManager([]*Rule{rule(2, "substr", "region", 0), rule(1, "substr", "split", 0)})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint{2, 1}, ids(em.GetAllRulesByLog(l)))
+
+	em, err = newEventManager([]*Rule{
+		rule(1, "substr", "region", 0),
+		rule(2, "substr", "split", 0, "region-id"),
+		rule(4, "regex", "split", 0),
+	})
+	assert.Nil(t, err)
+	l.Message = "split region 1 and 2"
+	assert.Equal(t, []uint{4, 2, 1}, ids(em.GetAllRulesByLog(l)))
+	l.Fields = nil
+	assert.Equal(t, []uint{4, 1}, ids(em.GetAllRulesByLog(l)))
+	assert.Equal(t, uint(4), em.GetLogEventID(l))
+}
+
+func TestComponentRules(t *testing.T) {
+	for i, tp := range AllComponentTypes() {
+		got, err := GetComponentType(strings.ToUpper(tp.String()))
+		assert.Nil(t, err)
+		assert.Equal(t, tp, got)
+
+		rs, err := loadRule([]ComponentType{tp}, nil)
+		assert.Nil(t, err)
+		if tp < ComponentDM {
+			continue
+		}
+		for _, r := range rs {
+			assert.GreaterOrEqual(t, r.ID, uint(i+1)*10000, r.Name)
+			assert.Less(t, r.ID, uint(i+2)*10000, r.Name)
+		}
+	}
+	tp, err := GetComponentType("cdc")
+	assert.Nil(t, err)
+	assert.Equal(t, ComponentTiCDC, tp)
+	_, err = GetComponentType("mysql")
+	assert.NotNil(t, err)
+
+	em, err := NewEventManager(ComponentDumpling, ComponentOperator)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(90003), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelError},
+		Message: "dump failed error stack info",
+	}))
+	assert.Equal(t, uint(100002), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelError},
+		Message: "TidbCluster: default/basic, sync failed pd is not ready, requeuing",
+	}))
+	assert.Equal(t, uint(100001), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelInfo},
+		Message: "TidbCluster: [default/basic] updated successfully",
+	}))
+	// the generic messages of other objects
+	assert.Equal(t, uint(0), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelInfo},
+		Message: "ConfigMap: [default/basic-pd] updated successfully",
+	}))
+	assert.Equal(t, uint(0), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelError},
+		Message: "backup sync failed",
+	}))
+
+	em, err = NewEventManager(ComponentDM)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelError},
+		Message: "meet error",
+	}))
+	assert.Equal(t, uint(60004), em.GetLogEventID(&parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelError},
+		Message: "meet error",
+		Fields:  []parser.LogField{{Name: "task", Value: "test"}},
+	}))
+}
+
+func TestRuleMetadata(t *testing.T) {
+	em, err := NewEventManager(ComponentTiDB)
+	assert.Nil(t, err)
+	r := em.GetRulesByEventID(10181)[0]
+	assert.Equal(t, SeverityCritical, r.Severity)
+	assert.Equal(t, "server", r.Category)
+	assert.Equal(t, []string{"panic"}, r.Tags)
+	assert.NotEmpty(t, r.Description)
+	assert.NotEmpty(t, r.Remediation)
+
+	// optional
+	r = em.GetRulesByEventID(10001)[0]
+	assert.Equal(t, RuleMetadata{}, r.RuleMetadata)
+}
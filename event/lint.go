@@ -0,0 +1,324 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/lucklove/tidb-log-parser/utils"
+)
+
+// The checks of the linter.
+const (
+	LintDuplicateID = "duplicate-id"
+	LintIDRange     = "id-range"
+	LintRegex       = "regex"
+	LintMessageMode = "message-mode"
+	LintLevel       = "level"
+	LintShadow      = "shadow"
+	LintCondition   = "condition"
+	LintSeverity    = "severity"
+	LintVersion     = "version"
+)
+
+// LintProblem is a problem of a rule found by the linter.
+type LintProblem struct {
+	// Source is the name of the catalog, eg. the file name.
+	Source string
+	// Line is the line of the "[[rule]]" in the catalog.
+	Line  int
+	Rule  *Rule
+	Check string
+	Msg   string
+}
+
+func (p *LintProblem) String() string {
+	return fmt.Sprintf("%s:%d: rule %d (%s): %s: %s", p.Source, p.Line, p.Rule.ID, p.Rule.Name, p.Check, p.Msg)
+}
+
+var logLevels = utils.NewStringSet(
+	string(parser.LogLevelTrace),
+	string(parser.LogLevelDebug),
+	string(parser.LogLevelInfo),
+	string(parser.LogLevelWarn),
+	string(parser.LogLevelError),
+	string(parser.LogLevelFatal),
+)
+
+var severities = utils.NewStringSet("", SeverityCritical, SeverityError, SeverityWarning, SeverityInfo)
+
+var messageModes = utils.NewStringSet("", "equal", "regex", "substr", "template")
+
+// LintEmbedded lints the embedded catalogs of all the components, they're
+// named like tidb.toml in the problems.
+func LintEmbedded() ([]*LintProblem, error) {
+	problems := []*LintProblem{}
+	for _, tp := range AllComponentTypes() {
+		tp := tp
+		ps, err := LintCatalog(tp.String()+".toml", ruleCatalogs[tp], &tp)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, ps...)
+	}
+	return problems, nil
+}
+
+// LintFile lints the catalog file, see LintCatalog.
+func LintFile(path string) ([]*LintProblem, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return LintCatalog(path, string(data), nil)
+}
+
+// LintReader lints the catalog read from the reader, see LintCatalog.
+func LintReader(name string, r io.Reader) ([]*LintProblem, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return LintCatalog(name, string(data), nil)
+}
+
+// LintCatalog checks the rules of a catalog for
+//
+//	duplicate-id: the rules with the same ID but different names or the same
+//	              patterns, the rules of an ID may have different patterns
+//	id-range:     the IDs out of the range of the component
+//	regex:        the messages of regex and template mode which don't compile
+//	message-mode: the unknown message modes
+//	level:        the unknown levels
+//	condition:    the field conditions with unknown ops or invalid values
+//	severity:     the unknown severities
+//	version:      the invalid versions and the empty version ranges
+//	shadow:       the rules which never match since every log they match is
+//	              matched by another rule first
+//
+// The component is the one the catalog is for, it's taken from the catalog
+// if it's nil, and the IDs aren't checked if neither tells. The error is
+// returned if the catalog can't be decoded.
+func LintCatalog(name, data string, tp *ComponentType) ([]*LintProblem, error) {
+	c, err := decodeRuleCatalog(name, data)
+	if err != nil {
+		return nil, err
+	}
+	if tp == nil && c.Component != "" {
+		ct, err := GetComponentType(c.Component)
+		if err != nil {
+			return nil, err
+		}
+		tp = &ct
+	}
+	lines := ruleLines(data)
+	l := &linter{source: name, rules: c.Rule, lines: lines, problems: []*LintProblem{}}
+	l.checkRules(tp)
+	l.checkDuplicates()
+	l.checkShadows()
+	return l.problems, nil
+}
+
+type linter struct {
+	source   string
+	rules    []*Rule
+	lines    []int
+	regexes  map[int]*regexp.Regexp
+	problems []*LintProblem
+}
+
+func (l *linter) report(i int, check, format string, args ...interface{}) {
+	l.problems = append(l.problems, &LintProblem{
+		Source: l.source,
+		Line:   l.line(i),
+		Rule:   l.rules[i],
+		Check:  check,
+		Msg:    fmt.Sprintf(format, args...),
+	})
+}
+
+func (l *linter) line(i int) int {
+	if i < len(l.lines) {
+		return l.lines[i]
+	}
+	return 0
+}
+
+func (l *linter) checkRules(tp *ComponentType) {
+	l.regexes = make(map[int]*regexp.Regexp)
+	for i, r := range l.rules {
+		if tp != nil {
+			if min, max := tp.IDRange(); r.ID < min || r.ID >= max {
+				l.report(i, LintIDRange, "ID %d is out of the range [%d, %d) of %s", r.ID, min, max, tp)
+			}
+		}
+		if !messageModes.Exist(r.Patterns.MessageMode) {
+			l.report(i, LintMessageMode, "unknown message_mode '%s'", r.Patterns.MessageMode)
+		}
+		if expr, ok, err := r.messageRegex(); err != nil {
+			l.report(i, LintRegex, "%s", err)
+		} else if ok {
+			regex, err := regexp.Compile(expr)
+			if err != nil {
+				l.report(i, LintRegex, "%s", err)
+			} else {
+				l.regexes[i] = regex
+			}
+		}
+		if !logLevels.Exist(r.Patterns.Level) {
+			l.report(i, LintLevel, "unknown level '%s'", r.Patterns.Level)
+		}
+		for _, c := range r.Patterns.Conditions {
+			if _, err := compileCondition(c); err != nil {
+				l.report(i, LintCondition, "%s", err)
+			}
+		}
+		if !severities.Exist(r.Severity) {
+			l.report(i, LintSeverity, "unknown severity '%s'", r.Severity)
+		}
+		if _, err := r.versionRange(); err != nil {
+			l.report(i, LintVersion, "%s", err)
+		}
+	}
+}
+
+func (l *linter) checkDuplicates() {
+	first := make(map[uint]int)
+	for i, r := range l.rules {
+		j, ok := first[r.ID]
+		if !ok {
+			first[r.ID] = i
+			continue
+		}
+		if r.Name != l.rules[j].Name {
+			l.report(i, LintDuplicateID, "ID %d is also used by '%s' at line %d", r.ID, l.rules[j].Name, l.line(j))
+		}
+	}
+	for i, r := range l.rules {
+		for j := 0; j < i; j++ {
+			if r.ID == l.rules[j].ID && samePatterns(r, l.rules[j]) {
+				l.report(i, LintDuplicateID, "same patterns as the rule at line %d", l.line(j))
+				break
+			}
+		}
+	}
+}
+
+// checkShadows reports the rules which never match since every log they
+// match is matched by a rule tried before them.
+func (l *linter) checkShadows() {
+	for i, r := range l.rules {
+		for j, s := range l.rules {
+			if i == j || !l.covers(j, i) || !l.precedes(j, i) {
+				continue
+			}
+			if r.ID == s.ID && samePatterns(r, s) {
+				// reported as duplicate
+				continue
+			}
+			l.report(i, LintShadow, "never matches, shadowed by rule %d at line %d", s.ID, l.line(j))
+			break
+		}
+	}
+}
+
+// precedes tells if the rule j is tried before the rule i, see GetRuleByLog.
+func (l *linter) precedes(j, i int) bool {
+	r, s := l.rules[i], l.rules[j]
+	rank := map[MessageModeType]int{MessageModeEqual: 0, MessageModeRegex: 1, MessageModeTemplate: 1, MessageModeSubstr: 2}
+	switch {
+	case rank[s.MessageMode()] != rank[r.MessageMode()]:
+		return rank[s.MessageMode()] < rank[r.MessageMode()]
+	case s.Priority != r.Priority:
+		return s.Priority > r.Priority
+	case s.specificity() != r.specificity():
+		return s.specificity() > r.specificity()
+	}
+	return j < i
+}
+
+// covers tells if the rule j matches every log the rule i matches.
+func (l *linter) covers(j, i int) bool {
+	r, s := &l.rules[i].Patterns, &l.rules[j].Patterns
+	if r.Level != s.Level {
+		return false
+	}
+	if len(utils.NewStringSet(s.Fields...).Difference(utils.NewStringSet(r.Fields...))) > 0 {
+		return false
+	}
+	if s.Continuation != "" && !strings.Contains(r.Continuation, s.Continuation) {
+		return false
+	}
+	for _, c := range s.Conditions {
+		if !hasCondition(r.Conditions, c) {
+			return false
+		}
+	}
+	rm, sm := l.rules[i].MessageMode(), l.rules[j].MessageMode()
+	switch {
+	case sm == MessageModeEqual:
+		return rm == MessageModeEqual && r.Message == s.Message
+	case sm == MessageModeSubstr:
+		return (rm == MessageModeEqual || rm == MessageModeSubstr) && strings.Contains(r.Message, s.Message)
+	case sm == MessageModeRegex || sm == MessageModeTemplate:
+		regex := l.regexes[j]
+		if regex == nil {
+			return false
+		}
+		return (rm == MessageModeEqual && regex.MatchString(r.Message)) ||
+			(rm == sm && r.Message == s.Message)
+	}
+	return false
+}
+
+func samePatterns(ra, rb *Rule) bool {
+	a, b := &ra.Patterns, &rb.Patterns
+	fa, fb := utils.NewStringSet(a.Fields...), utils.NewStringSet(b.Fields...)
+	if len(a.Conditions) != len(b.Conditions) {
+		return false
+	}
+	for _, c := range a.Conditions {
+		if !hasCondition(b.Conditions, c) {
+			return false
+		}
+	}
+	return a.Level == b.Level && a.Message == b.Message && ra.MessageMode() == rb.MessageMode() &&
+		a.Continuation == b.Continuation && len(fa.Difference(fb)) == 0 && len(fb.Difference(fa)) == 0
+}
+
+func hasCondition(cs []*FieldCondition, c *FieldCondition) bool {
+	for _, x := range cs {
+		if *x == *c {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleLines returns the line numbers of the "[[rule]]" in the catalog.
+func ruleLines(data string) []int {
+	lines := []int{}
+	for i, line := range strings.Split(data, "\n") {
+		if strings.TrimSpace(line) == "[[rule]]" {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,239 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const lintCatalog = `component = "pd"
+
+[[rule]]
+  id = 30001
+  name = "a"
+  [rule.patterns]
+    level = "INFO"
+    message = "a"
+    fields = ["x"]
+
+[[rule]]
+  id = 30001
+  name = "a"
+  [rule.patterns]
+    level = "WARN"
+    message = "a"
+    fields = ["x"]
+
+[[rule]]
+  id = 30001
+  name = "b"
+  [rule.patterns]
+    level = "ERROR"
+    message = "b"
+
+[[rule]]
+  id = 20001
+  name = "out of range"
+  [rule.patterns]
+    level = "INFO"
+    message = "out of range"
+
+[[rule]]
+  id = 30002
+  name = "bad regex"
+  [rule.patterns]
+    level = "INFO"
+    message = "bad ("
+    message_mode = "regex"
+
+[[rule]]
+  id = 30003
+  name = "bad mode"
+  [rule.patterns]
+    level = "INFO"
+    message = "bad mode"
+    message_mode = "prefix"
+
+[[rule]]
+  id = 30004
+  name = "bad level"
+  [rule.patterns]
+    level = "info"
+    message = "bad level"
+
+[[rule]]
+  id = 30005
+  name = "more specific than 30001"
+  [rule.patterns]
+    level = "INFO"
+    message = "a"
+    fields = ["x", "y"]
+
+[[rule]]
+  id = 30006
+  name = "substr"
+  priority = 1
+  [rule.patterns]
+    level = "INFO"
+    message = "region"
+    message_mode = "substr"
+
+[[rule]]
+  id = 30007
+  name = "shadowed by 30006"
+  [rule.patterns]
+    level = "INFO"
+    message = "region .* is stale"
+    message_mode = "substr"
+
+[[rule]]
+  id = 30008
+  name = "not shadowed by 30006"
+  [rule.patterns]
+    level = "INFO"
+    message = "region"
+
+[[rule]]
+  id = 30009
+  name = "shadowed by the priority of 30006"
+  [rule.patterns]
+    level = "INFO"
+    message = "region is stale"
+    message_mode = "substr"
+    fields = ["region-id"]
+`
+
+func TestLintCatalog(t *testing.T) {
+	problems, err := LintReader("pd-custom.toml", strings.NewReader(lintCatalog))
+	assert.Nil(t, err)
+	reported := []string{}
+	for _, p := range problems {
+		reported = append(reported, p.String())
+	}
+	assert.Equal(t, []string{
+		"pd-custom.toml:26: rule 20001 (out of range): id-range: ID 20001 is out of the range [30000, 40000) of pd",
+		"pd-custom.toml:33: rule 30002 (bad regex): regex: error parsing regexp: missing closing ): `bad (`",
+		"pd-custom.toml:41: rule 30003 (bad mode): message-mode: unknown message_mode 'prefix'",
+		"pd-custom.toml:49: rule 30004 (bad level): level: unknown level 'info'",
+		"pd-custom.toml:19: rule 30001 (b): duplicate-id: ID 30001 is also used by 'a' at line 3",
+		"pd-custom.toml:73: rule 30007 (shadowed by 30006): shadow: never matches, shadowed by rule 30006 at line 64",
+		"pd-custom.toml:88: rule 30009 (shadowed by the priority of 30006): shadow: never matches, shadowed by rule 30006 at line 64",
+	}, reported)
+
+	// the same patterns
+	problems, err = LintReader("dup.toml", strings.NewReader(`
+[[rule]]
+  id = 1
+  name = "a"
+  [rule.patterns]
+    level = "INFO"
+    message = "a"
+    fields = ["x", "y"]
+
+[[rule]]
+  id = 1
+  name = "a"
+  [rule.patterns]
+    level = "INFO"
+    message = "a"
+    message_mode = "equal"
+    fields = ["y", "x"]
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(problems))
+	assert.Equal(t, "dup.toml:10: rule 1 (a): duplicate-id: same patterns as the rule at line 2", problems[0].String())
+
+	// the conditions
+	problems, err = LintReader("conditions.toml", strings.NewReader(`
+[[rule]]
+  id = 1
+  name = "a"
+  [rule.patterns]
+    level = "INFO"
+    message = "a"
+    [[rule.patterns.conditions]]
+      field = "x"
+      op = "lt"
+      value = "x"
+
+[[rule]]
+  id = 2
+  name = "b"
+  [rule.patterns]
+    level = "INFO"
+    message = "b"
+    message_mode = "substr"
+    [[rule.patterns.conditions]]
+      field = "x"
+      op = "eq"
+      value = "1"
+
+[[rule]]
+  id = 3
+  name = "c"
+  [rule.patterns]
+    level = "INFO"
+    message = "bc"
+    message_mode = "substr"
+    [[rule.patterns.conditions]]
+      field = "x"
+      op = "eq"
+      value = "2"
+
+[[rule]]
+  id = 4
+  name = "d"
+  [rule.patterns]
+    level = "INFO"
+    message = "{x} and {x}"
+    message_mode = "template"
+
+[[rule]]
+  id = 5
+  name = "e"
+  severity = "fatal"
+  [rule.patterns]
+    level = "INFO"
+    message = "e"
+
+[[rule]]
+  id = 6
+  name = "f"
+  min_version = "v5.0.0"
+  max_version = "v4.0.0"
+  [rule.patterns]
+    level = "INFO"
+    message = "f"
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(problems))
+	assert.Equal(t, "conditions.toml:2: rule 1 (a): condition: condition on x: 'x' is not a number", problems[0].String())
+	assert.Equal(t, "conditions.toml:37: rule 4 (d): regex: duplicate placeholder {x} in template '{x} and {x}'", problems[1].String())
+	assert.Equal(t, "conditions.toml:45: rule 5 (e): severity: unknown severity 'fatal'", problems[2].String())
+	assert.Equal(t, "conditions.toml:53: rule 6 (f): version: empty version range [v5.0.0, v4.0.0) of rule 6 (f)", problems[3].String())
+
+	_, err = LintReader("bad.toml", strings.NewReader("[[rule]"))
+	assert.NotNil(t, err)
+
+	// the embedded catalogs have no problem
+	problems, err = LintEmbedded()
+	assert.Nil(t, err)
+	for _, p := range problems {
+		t.Error(p)
+	}
+}
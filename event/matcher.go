@@ -0,0 +1,250 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/pingcap/errors"
+)
+
+// matcher finds the rules matched by a log in the order of GetRuleByLog
+// without trying every rule. The rules of equal mode are looked up by the
+// message. The rules of regex and substr mode are numbered in the order of
+// matching, and only the ones whose literals are in the message are tried,
+// ie. the message of substr mode and the literal a regex requires, which
+// are all found in one pass by an Aho-Corasick automaton.
+type matcher struct {
+	exact map[string][]*compiledRule
+	// the rules of regex and substr mode in the order of matching
+	rules    []*compiledRule
+	literals *acAutomaton
+	// literalRules are the rules requiring every literal
+	literalRules [][]int
+	// unindexed are the rules requiring no literal, eg. "^\d+$"
+	unindexed []int
+}
+
+type compiledRule struct {
+	*Rule
+	regex      *regexp.Regexp
+	level      parser.LogLevel
+	conditions []*compiledCondition
+}
+
+func compileRule(r *Rule, regex *regexp.Regexp) (*compiledRule, error) {
+	cr := &compiledRule{Rule: r, regex: regex, level: parser.LogLevel(r.Patterns.Level)}
+	for _, c := range r.Patterns.Conditions {
+		cc, err := compileCondition(c)
+		if err != nil {
+			return nil, errors.Annotatef(err, "rule %d (%s)", r.ID, r.Name)
+		}
+		cr.conditions = append(cr.conditions, cc)
+	}
+	return cr, nil
+}
+
+func newMatcher(exact map[string][]*Rule, regexRules, substrRules []*Rule, regexes map[string]*regexp.Regexp) (*matcher, error) {
+	m := &matcher{exact: make(map[string][]*compiledRule, len(exact))}
+	for msg, rules := range exact {
+		for _, r := range rules {
+			cr, err := compileRule(r, nil)
+			if err != nil {
+				return nil, err
+			}
+			m.exact[msg] = append(m.exact[msg], cr)
+		}
+	}
+
+	literals := []string{}
+	literalIndex := make(map[string]int)
+	add := func(r *Rule, expr, literal string) error {
+		cr, err := compileRule(r, regexes[expr])
+		if err != nil {
+			return err
+		}
+		pos := len(m.rules)
+		m.rules = append(m.rules, cr)
+		if literal == "" {
+			m.unindexed = append(m.unindexed, pos)
+			return nil
+		}
+		i, ok := literalIndex[literal]
+		if !ok {
+			i = len(literals)
+			literalIndex[literal] = i
+			literals = append(literals, literal)
+			m.literalRules = append(m.literalRules, nil)
+		}
+		m.literalRules[i] = append(m.literalRules[i], pos)
+		return nil
+	}
+	for _, r := range regexRules {
+		expr, _, err := r.messageRegex()
+		if err != nil {
+			return nil, err
+		}
+		if err := add(r, expr, requiredLiteral(expr)); err != nil {
+			return nil, err
+		}
+	}
+	for _, r := range substrRules {
+		if err := add(r, "", r.Patterns.Message); err != nil {
+			return nil, err
+		}
+	}
+	m.literals = newACAutomaton(literals)
+	return m, nil
+}
+
+// match returns the rules matched the log in order, only the first one if
+// all is false.
+func (m *matcher) match(l *parser.LogEntry, all bool) []*compiledRule {
+	fields := logFields{log: l}
+	matched := []*compiledRule{}
+	for _, r := range m.exact[l.Message] {
+		if r.matchPatterns(l, &fields) {
+			matched = append(matched, r)
+			if !all {
+				return matched
+			}
+		}
+	}
+
+	candidates := append([]int{}, m.unindexed...)
+	m.literals.find(l.Message, func(literal int) {
+		candidates = append(candidates, m.literalRules[literal]...)
+	})
+	sort.Ints(candidates)
+	for i, pos := range candidates {
+		if i > 0 && candidates[i-1] == pos {
+			continue
+		}
+		r := m.rules[pos]
+		if r.regex != nil && !r.regex.MatchString(l.Message) {
+			continue
+		}
+		if r.matchPatterns(l, &fields) {
+			matched = append(matched, r)
+			if !all {
+				return matched
+			}
+		}
+	}
+	return matched
+}
+
+// matchPatterns tells if the log matches the patterns besides the message.
+func (r *compiledRule) matchPatterns(l *parser.LogEntry, fields *logFields) bool {
+	if r.level != l.Header.Level {
+		return false
+	}
+	if r.Patterns.Continuation != "" && !continuationContains(l, r.Patterns.Continuation) {
+		return false
+	}
+	for _, f := range r.Patterns.Fields {
+		if _, ok := fields.value(f); !ok {
+			return false
+		}
+	}
+	for _, c := range r.conditions {
+		if !c.match(fields.value(c.Field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// logFieldsIndexed is the number of fields over which the names of the
+// fields are indexed by a map rather than scanned.
+const logFieldsIndexed = 8
+
+// logFields looks up the fields of a log, the index is built at the first
+// lookup and only for a log with many fields.
+type logFields struct {
+	log   *parser.LogEntry
+	index map[string]string
+}
+
+// value returns the value of the first field of the name, ok is false if
+// there is no such field.
+func (lf *logFields) value(name string) (value string, ok bool) {
+	if len(lf.log.Fields) <= logFieldsIndexed {
+		for _, f := range lf.log.Fields {
+			if f.Name == name {
+				return f.Value, true
+			}
+		}
+		return "", false
+	}
+	if lf.index == nil {
+		lf.index = make(map[string]string, len(lf.log.Fields))
+		for _, f := range lf.log.Fields {
+			if _, ok := lf.index[f.Name]; !ok {
+				lf.index[f.Name] = f.Value
+			}
+		}
+	}
+	value, ok = lf.index[name]
+	return
+}
+
+// requiredLiteral returns the longest literal in every string the regex
+// matches, it's empty if there is no such literal or it's case insensitive.
+func requiredLiteral(expr string) string {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	return longestLiteral(re.Simplify())
+}
+
+func longestLiteral(re *syntax.Regexp) string {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return ""
+		}
+		return string(re.Rune)
+	case syntax.OpCapture, syntax.OpPlus:
+		return longestLiteral(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min > 0 {
+			return longestLiteral(re.Sub[0])
+		}
+	case syntax.OpConcat:
+		longest := ""
+		for _, sub := range re.Sub {
+			if s := longestLiteral(sub); len(s) > len(longest) {
+				longest = s
+			}
+		}
+		return longest
+	}
+	return ""
+}
+
+func continuationContains(l *parser.LogEntry, s string) bool {
+	for _, line := range l.Continuation {
+		if strings.Contains(line, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACAutomaton(t *testing.T) {
+	ac := newACAutomaton([]string{"he", "she", "his", "hers", "e"})
+	found := []int{}
+	ac.find("ushers", func(p int) { found = append(found, p) })
+	sort.Ints(found)
+	assert.Equal(t, []int{0, 1, 3, 4}, found)
+
+	found = found[:0]
+	ac.find("eee", func(p int) { found = append(found, p) })
+	assert.Equal(t, []int{4, 4, 4}, found)
+
+	found = found[:0]
+	newACAutomaton(nil).find("anything", func(p int) { found = append(found, p) })
+	assert.Empty(t, found)
+}
+
+func TestRequiredLiteral(t *testing.T) {
+	for expr, literal := range map[string]string{
+		`^load region \d+ failed$`:        "load region ",
+		`schema version (\d+) is too old`: "schema version ",
+		`(?i)welcome`:                     "",
+		`^\d+$`:                           "",
+		`a|bc`:                            "",
+		`(prepare)+ failed`:               "prepare",
+		`x{2,3}yy`:                        "yy",
+		`(`:                               "",
+	} {
+		assert.Equal(t, literal, requiredLiteral(expr), expr)
+	}
+}
+
+// linearMatch is the plain matching the indexed one must agree with.
+func linearMatch(rs []*Rule, l *parser.LogEntry) []*Rule {
+	exact, regexRules, substrRules := []*Rule{}, []*Rule{}, []*Rule{}
+	for _, r := range rs {
+		switch r.MessageMode() {
+		case MessageModeRegex:
+			regexRules = append(regexRules, r)
+		case MessageModeSubstr:
+			substrRules = append(substrRules, r)
+		default:
+			exact = append(exact, r)
+		}
+	}
+	sortRules(exact)
+	sortRules(regexRules)
+	sortRules(substrRules)
+	matched := []*Rule{}
+	for _, r := range append(append(exact, regexRules...), substrRules...) {
+		switch r.MessageMode() {
+		case MessageModeRegex:
+			if !regexp.MustCompile(r.Patterns.Message).MatchString(l.Message) {
+				continue
+			}
+		case MessageModeSubstr:
+			if !strings.Contains(l.Message, r.Patterns.Message) {
+				continue
+			}
+		default:
+			if l.Message != r.Patterns.Message {
+				continue
+			}
+		}
+		if r.Patterns.Level != string(l.Header.Level) {
+			continue
+		}
+		if r.Patterns.Continuation != "" && !continuationContains(l, r.Patterns.Continuation) {
+			continue
+		}
+		fields := true
+		for _, f := range r.Patterns.Fields {
+			has := false
+			for _, lf := range l.Fields {
+				has = has || lf.Name == f
+			}
+			fields = fields && has
+		}
+		if fields {
+			matched = append(matched, r)
+		}
+	}
+	return matched
+}
+
+func TestIndexedMatch(t *testing.T) {
+	words := []string{"region", "store", "load", "failed", "peer", "", "a", "ab"}
+	messages := []string{"load region", "region failed", "a", "store peer", "ab", "", "load region failed", "peer ab peer"}
+	regexes := []string{`^load`, `failed$`, `(?i)STORE`, `\w+ peer`, `^$`, `re(gion|store)`, `a+b`}
+	levels := []parser.LogLevel{parser.LogLevelInfo, parser.LogLevelWarn}
+	fields := []string{"id", "cost", "f0", "f1", "f2", "f3", "f4", "f5", "f6", "f7"}
+
+	rnd := rand.New(rand.NewSource(1))
+	pick := func(xs []string) string { return xs[rnd.Intn(len(xs))] }
+	rs := []*Rule{}
+	for i := 0; i < 300; i++ {
+		r := &Rule{ID: uint(i % 50), Priority: rnd.Intn(3), Patterns: RulePattern{Level: string(levels[rnd.Intn(len(levels))])}}
+		switch rnd.Intn(3) {
+		case 0:
+			r.Patterns.Message = pick(messages)
+		case 1:
+			r.Patterns.Message, r.Patterns.MessageMode = pick(regexes), "regex"
+		default:
+			r.Patterns.Message, r.Patterns.MessageMode = pick(words), "substr"
+		}
+		for j := rnd.Intn(3); j > 0; j-- {
+			r.Patterns.Fields = append(r.Patterns.Fields, pick(fields))
+		}
+		if rnd.Intn(5) == 0 {
+			r.Patterns.Continuation = pick(words[:4])
+		}
+		rs = append(rs, r)
+	}
+	em, err := newEventManager(rs)
+	assert.Nil(t, err)
+
+	for i := 0; i < 2000; i++ {
+		l := &parser.LogEntry{Header: parser.LogHeader{Level: levels[rnd.Intn(len(levels))]}, Message: pick(messages)}
+		if rnd.Intn(2) == 0 {
+			l.Message += " " + pick(words)
+		}
+		for j := rnd.Intn(len(fields) + 1); j > 0; j-- {
+			l.Fields = append(l.Fields, parser.LogField{Name: pick(fields)})
+		}
+		if rnd.Intn(3) == 0 {
+			l.Continuation = []string{pick(words)}
+		}
+		expected := linearMatch(rs, l)
+		assert.Equal(t, expected, em.GetAllRulesByLog(l), l.Message)
+		if len(expected) > 0 {
+			assert.Equal(t, expected[0], em.GetRuleByLog(l))
+		} else {
+			assert.Nil(t, em.GetRuleByLog(l))
+		}
+	}
+}
+
+// benchLogs returns the logs to match, they're parsed from the file of
+// EVENT_BENCH_LOG if it's set, eg. a real tidb.log, or made of the messages
+// of the embedded catalogs and some messages matching nothing.
+func benchLogs(b *testing.B, rs []*Rule) []*parser.LogEntry {
+	if path := os.Getenv("EVENT_BENCH_LOG"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer f.Close()
+		logs, _, err := parser.ParseFromReaderLenient(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		return logs
+	}
+	logs := []*parser.LogEntry{}
+	for i, r := range rs {
+		l := &parser.LogEntry{Header: parser.LogHeader{Level: parser.LogLevel(r.Patterns.Level)}, Message: r.Patterns.Message}
+		if r.MessageMode() == MessageModeRegex {
+			l.Message = fmt.Sprintf("unmatched message %d of a regex rule", i)
+		}
+		for _, f := range r.Patterns.Fields {
+			l.Fields = append(l.Fields, parser.LogField{Name: f, Value: "1"})
+		}
+		logs = append(logs, l, &parser.LogEntry{
+			Header:  parser.LogHeader{Level: parser.LogLevelInfo},
+			Message: fmt.Sprintf("[%d] unknown message matching no rule", i),
+		})
+	}
+	return logs
+}
+
+// The cost of matching a log doesn't grow with the size of the catalog,
+// compare them with go test -run XXX -bench GetRuleByLog
+func BenchmarkGetRuleByLog(b *testing.B) {
+	rs, err := loadRule(nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	logs := benchLogs(b, rs)
+	for _, extra := range []int{0, 1000, 10000} {
+		catalog := append([]*Rule{}, rs...)
+		for i := 0; i < extra; i++ {
+			r := &Rule{ID: uint(200000 + i), Patterns: RulePattern{Level: string(parser.LogLevelInfo)}}
+			switch i % 3 {
+			case 0:
+				r.Patterns.Message = fmt.Sprintf("extra message %d", i)
+			case 1:
+				r.Patterns.Message, r.Patterns.MessageMode = fmt.Sprintf("extra substr %d", i), "substr"
+			default:
+				r.Patterns.Message, r.Patterns.MessageMode = fmt.Sprintf(`^extra regex %d: \d+$`, i), "regex"
+			}
+			catalog = append(catalog, r)
+		}
+		em, err := newEventManager(catalog)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fmt.Sprintf("rules=%d", len(catalog)), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				em.GetRuleByLog(logs[i%len(logs)])
+			}
+		})
+	}
+}
@@ -17,9 +17,8 @@ package event
 import (
 	_ "embed"
 	"fmt"
+	"sort"
 	"strings"
-
-	"github.com/BurntSushi/toml"
 )
 
 //go:embed tidb.toml
@@ -37,6 +36,21 @@ var lightningRuleStr string
 //go:embed tiflash.toml
 var tiflashRuleStr string
 
+//go:embed dm.toml
+var dmRuleStr string
+
+//go:embed ticdc.toml
+var ticdcRuleStr string
+
+//go:embed br.toml
+var brRuleStr string
+
+//go:embed dumpling.toml
+var dumplingRuleStr string
+
+//go:embed tidb-operator.toml
+var operatorRuleStr string
+
 type ComponentType int
 type MessageModeType int
 
@@ -46,17 +60,63 @@ const (
 	ComponentPD        ComponentType = iota
 	ComponentLightning ComponentType = iota
 	ComponentTiFlash   ComponentType = iota
+	ComponentDM        ComponentType = iota
+	ComponentTiCDC     ComponentType = iota
+	ComponentBR        ComponentType = iota
+	ComponentDumpling  ComponentType = iota
+	ComponentOperator  ComponentType = iota
 
-	MessageModeEqual  MessageModeType = iota
-	MessageModeRegex  MessageModeType = iota
-	MessageModeSubstr MessageModeType = iota
+	MessageModeEqual    MessageModeType = iota
+	MessageModeRegex    MessageModeType = iota
+	MessageModeSubstr   MessageModeType = iota
+	MessageModeTemplate MessageModeType = iota
 )
 
 // Rule indicates how to convert LogEntry to event
 type Rule struct {
-	ID       uint        `toml:"id"`
-	Name     string      `toml:"name"`
-	Patterns RulePattern `toml:"patterns"`
+	ID   uint   `toml:"id"`
+	Name string `toml:"name"`
+	// Priority decides the rule tried first among the ones of the same
+	// message mode, the higher the earlier, 0 by default.
+	Priority int `toml:"priority,omitempty"`
+	// MinVersion and MaxVersion, if not empty, restrict the rule to the
+	// versions [MinVersion, MaxVersion) of the component, see ForVersion.
+	MinVersion string      `toml:"min_version,omitempty"`
+	MaxVersion string      `toml:"max_version,omitempty"`
+	Patterns   RulePattern `toml:"patterns"`
+
+	RuleMetadata
+}
+
+// The severities of RuleMetadata.
+const (
+	SeverityCritical = "critical"
+	SeverityError    = "error"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// RuleMetadata tells what the event means, all of it is optional, eg.
+//
+//	[[rule]]
+//	  id = 10005
+//	  name = "Welcome to TiDB."
+//	  severity = "info"
+//	  category = "startup"
+//	  tags = ["restart"]
+//	  description = "TiDB is started."
+//	  remediation = "Check the logs before it for the cause if it's unexpected."
+//	  links = ["https://docs.pingcap.com/tidb/stable/tidb-configuration-file"]
+type RuleMetadata struct {
+	// Severity is one of critical, error, warning and info.
+	Severity string `toml:"severity,omitempty"`
+	// Category is the subsystem of the event, eg. ddl, raft, scheduling, gc.
+	Category    string   `toml:"category,omitempty"`
+	Tags        []string `toml:"tags,omitempty"`
+	Description string   `toml:"description,omitempty"`
+	// Remediation is the known issue or what to do about the event.
+	Remediation string   `toml:"remediation,omitempty"`
+	Links       []string `toml:"links,omitempty"`
 }
 
 // RulePattern is a selector which describle how the LogEntry looks like
@@ -65,72 +125,172 @@ type RulePattern struct {
 	Message     string   `toml:"message"`
 	MessageMode string   `toml:"message_mode"`
 	Fields      []string `toml:"fields"`
+
+	// Continuation, if not empty, requires one of the continuation lines
+	// (eg. the stack trace) of the LogEntry to contain it.
+	Continuation string `toml:"continuation,omitempty"`
+
+	// Conditions, if any, constrain the values of the fields.
+	Conditions []*FieldCondition `toml:"conditions,omitempty"`
+}
+
+// componentNames are the names of the components, the first one of each
+// is the canonical name.
+var componentNames = map[ComponentType][]string{
+	ComponentTiDB:      {"tidb"},
+	ComponentTiKV:      {"tikv"},
+	ComponentPD:        {"pd"},
+	ComponentLightning: {"tidb-lightning", "lightning"},
+	ComponentTiFlash:   {"tiflash"},
+	ComponentDM:        {"dm", "dm-master", "dm-worker"},
+	ComponentTiCDC:     {"ticdc", "cdc"},
+	ComponentBR:        {"br"},
+	ComponentDumpling:  {"dumpling"},
+	ComponentOperator:  {"tidb-operator", "operator"},
+}
+
+// The IDs of the rules are allocated by component:
+//
+//	TiDB       10000 - 19999
+//	TiKV       20000 - 29999
+//	PD         30000 - 39999
+//	Lightning  40000 - 49999
+//	TiFlash    50000 - 59999
+//	DM         60000 - 69999
+//	TiCDC      70000 - 79999
+//	BR         80000 - 89999
+//	Dumpling   90000 - 99999
+//	Operator  100000 - 109999
+var ruleIDBases = map[ComponentType]uint{
+	ComponentTiDB:      10000,
+	ComponentTiKV:      20000,
+	ComponentPD:        30000,
+	ComponentLightning: 40000,
+	ComponentTiFlash:   50000,
+	ComponentDM:        60000,
+	ComponentTiCDC:     70000,
+	ComponentBR:        80000,
+	ComponentDumpling:  90000,
+	ComponentOperator:  100000,
+}
+
+const ruleIDRangeSize = 10000
+
+// IDRange returns the range [min, max) of the rule IDs of the component.
+func (tp ComponentType) IDRange() (uint, uint) {
+	base := ruleIDBases[tp]
+	return base, base + ruleIDRangeSize
+}
+
+var ruleCatalogs = map[ComponentType]string{
+	ComponentTiDB:      tidbRuleStr,
+	ComponentTiKV:      tikvRuleStr,
+	ComponentPD:        pdRuleStr,
+	ComponentLightning: lightningRuleStr,
+	ComponentTiFlash:   tiflashRuleStr,
+	ComponentDM:        dmRuleStr,
+	ComponentTiCDC:     ticdcRuleStr,
+	ComponentBR:        brRuleStr,
+	ComponentDumpling:  dumplingRuleStr,
+	ComponentOperator:  operatorRuleStr,
+}
+
+// AllComponentTypes returns all the supported components.
+func AllComponentTypes() []ComponentType {
+	return []ComponentType{
+		ComponentTiDB, ComponentTiKV, ComponentPD, ComponentLightning, ComponentTiFlash,
+		ComponentDM, ComponentTiCDC, ComponentBR, ComponentDumpling, ComponentOperator,
+	}
 }
 
 func GetComponentType(component string) (ComponentType, error) {
-	switch strings.ToLower(component) {
-	case "tidb":
-		return ComponentTiDB, nil
-	case "tikv":
-		return ComponentTiKV, nil
-	case "pd":
-		return ComponentPD, nil
-	case "tidb-lightning":
-		return ComponentLightning, nil
-	case "tiflash":
-		return ComponentTiFlash, nil
+	lower := strings.ToLower(component)
+	for _, tp := range AllComponentTypes() {
+		for _, name := range componentNames[tp] {
+			if name == lower {
+				return tp, nil
+			}
+		}
 	}
 	return ComponentType(0), fmt.Errorf("not supported component: %s", component)
 }
 
+// String returns the canonical name of the component.
+func (tp ComponentType) String() string {
+	if names, ok := componentNames[tp]; ok {
+		return names[0]
+	}
+	return fmt.Sprintf("ComponentType(%d)", int(tp))
+}
+
+// specificity is the number of the patterns besides the message and level.
+func (r *Rule) specificity() int {
+	n := len(r.Patterns.Fields) + len(r.Patterns.Conditions)
+	if r.Patterns.Continuation != "" {
+		n++
+	}
+	return n
+}
+
+// sortRules sorts the rules of the same message mode in the order of
+// matching, ie. by priority and then specificity, the order of the rules
+// as specific is kept.
+func sortRules(rules []*Rule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].specificity() > rules[j].specificity()
+	})
+}
+
 func (r *Rule) MessageMode() MessageModeType {
 	switch r.Patterns.MessageMode {
 	case "regex":
 		return MessageModeRegex
 	case "substr":
 		return MessageModeSubstr
+	case "template":
+		return MessageModeTemplate
 	default:
 		return MessageModeEqual
 	}
 }
 
-func loadRule(tps ...ComponentType) ([]*Rule, error) {
+// loadRule loads the rules of the components from the embedded catalogs
+// and then the sources, see loadRuleSources for the precedence. The files
+// of the sources are read once for all the components, and the rules of a
+// catalog without component, which are loaded for every component, are
+// kept once.
+func loadRule(tps []ComponentType, sources []RuleSource) ([]*Rule, error) {
 	if len(tps) == 0 {
-		tps = []ComponentType{
-			ComponentTiDB, ComponentTiKV, ComponentPD, ComponentLightning, ComponentTiFlash,
+		tps = AllComponentTypes()
+	}
+	loaded := []RuleSource{embeddedRules{}}
+	for _, source := range sources {
+		if cr, ok := source.(catalogReader); ok {
+			cs, err := cr.readCatalogs()
+			if err != nil {
+				return nil, err
+			}
+			source = cs
 		}
+		loaded = append(loaded, source)
 	}
 
 	rules := []*Rule{}
+	kept := make(map[*Rule]bool)
 	for _, tp := range tps {
-		rs := struct {
-			Rule []*Rule `toml:"rule"`
-		}{}
-		switch tp {
-		case ComponentTiDB:
-			if _, err := toml.Decode(tidbRuleStr, &rs); err != nil {
-				return nil, err
-			}
-		case ComponentTiKV:
-			if _, err := toml.Decode(tikvRuleStr, &rs); err != nil {
-				return nil, err
-			}
-		case ComponentPD:
-			if _, err := toml.Decode(pdRuleStr, &rs); err != nil {
-				return nil, err
-			}
-		case ComponentLightning:
-			if _, err := toml.Decode(lightningRuleStr, &rs); err != nil {
-				return nil, err
-			}
-		case ComponentTiFlash:
-			if _, err := toml.Decode(tiflashRuleStr, &rs); err != nil {
-				return nil, err
+		rs, err := loadRuleSources(tp, loaded...)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rs {
+			if !kept[r] {
+				kept[r] = true
+				rules = append(rules, r)
 			}
-		default:
-			panic("unreachable")
 		}
-		rules = append(rules, rs.Rule...)
 	}
 	return rules, nil
 }
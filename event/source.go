@@ -0,0 +1,237 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pingcap/errors"
+)
+
+// RuleSource provides the rules in addition to the embedded catalogs. A rule
+// catalog is a TOML file in the format of the embedded ones, with an optional
+// component at the top to restrict the rules to the component:
+//
+//	component = "tidb"
+//
+//	[[rule]]
+//	  id = 10001
+//	  ...
+//
+// The rules of a catalog without component apply to every component.
+type RuleSource interface {
+	// LoadRules returns the rules of the source for the component.
+	LoadRules(tp ComponentType) ([]*Rule, error)
+}
+
+type ruleCatalog struct {
+	Component string  `toml:"component"`
+	Rule      []*Rule `toml:"rule"`
+}
+
+// rules returns the rules of the catalog for the component.
+func (c *ruleCatalog) rules(tp ComponentType) ([]*Rule, error) {
+	if c.Component == "" {
+		return c.Rule, nil
+	}
+	ct, err := GetComponentType(c.Component)
+	if err != nil {
+		return nil, err
+	}
+	if ct != tp {
+		return nil, nil
+	}
+	return c.Rule, nil
+}
+
+func decodeRuleCatalog(name, data string) (*ruleCatalog, error) {
+	c := &ruleCatalog{}
+	if _, err := toml.Decode(data, c); err != nil {
+		return nil, errors.Annotatef(err, "decode rules of %s", name)
+	}
+	return c, nil
+}
+
+// catalogs is the RuleSource of the catalogs read, the later ones override
+// the earlier ones.
+type catalogs []*ruleCatalog
+
+func (cs catalogs) LoadRules(tp ComponentType) ([]*Rule, error) {
+	sources := make([]RuleSource, 0, len(cs))
+	for _, c := range cs {
+		sources = append(sources, &ruleReader{c})
+	}
+	return loadRuleSources(tp, sources...)
+}
+
+// catalogReader is a RuleSource reading its catalogs every time the rules
+// are loaded, they're read once when the rules of many components are
+// loaded together, see loadRule.
+type catalogReader interface {
+	readCatalogs() (catalogs, error)
+}
+
+type ruleFile string
+
+// RuleFile returns the RuleSource of a catalog file, it's read every time the
+// rules are loaded.
+func RuleFile(path string) RuleSource {
+	return ruleFile(path)
+}
+
+func (f ruleFile) LoadRules(tp ComponentType) ([]*Rule, error) {
+	cs, err := f.readCatalogs()
+	if err != nil {
+		return nil, err
+	}
+	return cs.LoadRules(tp)
+}
+
+func (f ruleFile) readCatalogs() (catalogs, error) {
+	data, err := ioutil.ReadFile(string(f))
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeRuleCatalog(string(f), string(data))
+	if err != nil {
+		return nil, err
+	}
+	if c.Component != "" {
+		if _, err := GetComponentType(c.Component); err != nil {
+			return nil, errors.Annotatef(err, "load rules of %s", f)
+		}
+	}
+	return catalogs{c}, nil
+}
+
+type ruleDir string
+
+// RuleDir returns the RuleSource of the *.toml catalogs in the directory,
+// which are loaded in the order of their names, so the later ones override
+// the earlier ones.
+func RuleDir(dir string) RuleSource {
+	return ruleDir(dir)
+}
+
+func (d ruleDir) LoadRules(tp ComponentType) ([]*Rule, error) {
+	cs, err := d.readCatalogs()
+	if err != nil {
+		return nil, err
+	}
+	return cs.LoadRules(tp)
+}
+
+func (d ruleDir) readCatalogs() (catalogs, error) {
+	paths, err := filepath.Glob(filepath.Join(string(d), "*.toml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	cs := catalogs{}
+	for _, path := range paths {
+		c, err := ruleFile(path).readCatalogs()
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, c...)
+	}
+	return cs, nil
+}
+
+// RulePath returns the RuleSource of a catalog file or a directory of them.
+func RulePath(path string) (RuleSource, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return RuleDir(path), nil
+	}
+	return RuleFile(path), nil
+}
+
+type ruleReader struct {
+	catalog *ruleCatalog
+}
+
+// RuleReader returns the RuleSource of the catalog read from the reader, it's
+// read at once and the name is used in the errors.
+func RuleReader(name string, r io.Reader) (RuleSource, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	c, err := decodeRuleCatalog(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+	if c.Component != "" {
+		if _, err := GetComponentType(c.Component); err != nil {
+			return nil, errors.Annotatef(err, "load rules of %s", name)
+		}
+	}
+	return &ruleReader{c}, nil
+}
+
+func (r *ruleReader) LoadRules(tp ComponentType) ([]*Rule, error) {
+	return r.catalog.rules(tp)
+}
+
+// embeddedRules is the RuleSource of the embedded catalogs.
+type embeddedRules struct{}
+
+func (embeddedRules) LoadRules(tp ComponentType) ([]*Rule, error) {
+	catalog, ok := ruleCatalogs[tp]
+	if !ok {
+		panic("unreachable")
+	}
+	c, err := decodeRuleCatalog(tp.String(), catalog)
+	if err != nil {
+		return nil, err
+	}
+	return c.Rule, nil
+}
+
+// loadRuleSources loads the rules of the sources in order, the rules of a
+// source replace all the rules with the same ID of the sources before it.
+func loadRuleSources(tp ComponentType, sources ...RuleSource) ([]*Rule, error) {
+	rules := []*Rule{}
+	for _, source := range sources {
+		rs, err := source.LoadRules(tp)
+		if err != nil {
+			return nil, err
+		}
+		if len(rs) == 0 {
+			continue
+		}
+		overridden := make(map[uint]bool)
+		for _, r := range rs {
+			overridden[r.ID] = true
+		}
+		kept := rules[:0]
+		for _, r := range rules {
+			if !overridden[r.ID] {
+				kept = append(kept, r)
+			}
+		}
+		rules = append(kept, rs...)
+	}
+	return rules, nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	// override the embedded rule of PD
+	write("a.toml", `
+component = "pd"
+
+[[rule]]
+  id = 30001
+  name = "custom schedule command"
+  [rule.patterns]
+    level = "INFO"
+    message = "send schedule command"
+    fields = []
+`)
+	// override the rule of a.toml, for every component
+	write("b.toml", `
+[[rule]]
+  id = 30001
+  name = "custom schedule command of b"
+  [rule.patterns]
+    level = "WARN"
+    message = "send schedule command"
+    fields = []
+`)
+	write("ignored.txt", `garbage`)
+	other := write("tikv.rules", `
+component = "tikv"
+
+[[rule]]
+  id = 29999
+  name = "custom tikv"
+  [rule.patterns]
+    level = "INFO"
+    message = "custom tikv"
+    fields = []
+`)
+
+	log := &parser.LogEntry{
+		Header:  parser.LogHeader{Level: parser.LogLevelInfo},
+		Message: "send schedule command",
+	}
+
+	em, err := NewEventManagerWithSources([]ComponentType{ComponentPD}, RuleFile(filepath.Join(dir, "a.toml")))
+	assert.Nil(t, err)
+	assert.Equal(t, uint(30001), em.GetLogEventID(log))
+	assert.Equal(t, "custom schedule command", em.GetRulesByEventID(30001)[0].Name)
+	assert.Equal(t, 1, len(em.GetRulesByEventID(30001)))
+
+	source, err := RulePath(dir)
+	assert.Nil(t, err)
+	em, err = NewEventManagerWithSources([]ComponentType{ComponentPD}, source)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(0), em.GetLogEventID(log))
+	log.Header.Level = parser.LogLevelWarn
+	assert.Equal(t, uint(30001), em.GetLogEventID(log))
+
+	// the rules for every component are loaded once for all the components
+	em, err = NewEventManagerWithSources(nil, source)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(em.GetRulesByEventID(30001)))
+	assert.Equal(t, 1, len(em.GetAllRulesByLog(log)))
+	em, err = NewEventManagerWithSources(nil, RuleFile(filepath.Join(dir, "b.toml")))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(em.GetRulesByEventID(30001)))
+
+	// the rules with the same ID of a catalog are all kept, however many
+	// components are loaded
+	twice := write("twice.rules", `
+[[rule]]
+  id = 1
+  name = "twice"
+  [rule.patterns]
+    level = "INFO"
+    message = "twice"
+
+[[rule]]
+  id = 1
+  name = "twice"
+  [rule.patterns]
+    level = "INFO"
+    message = "twice"
+`)
+	for _, tps := range [][]ComponentType{{ComponentPD}, nil} {
+		em, err = NewEventManagerWithSources(tps, RuleFile(twice))
+		assert.Nil(t, err)
+		assert.Equal(t, 2, len(em.GetRulesByEventID(1)))
+	}
+
+	// the override is scoped to the component
+	scoped := write("scoped.rules", `
+component = "tikv"
+
+[[rule]]
+  id = 30001
+  name = "custom schedule command of tikv"
+  [rule.patterns]
+    level = "INFO"
+    message = "send schedule command"
+    fields = []
+`)
+	em, err = NewEventManagerWithSources(nil, RuleFile(scoped))
+	assert.Nil(t, err)
+	rs := em.GetRulesByEventID(30001)
+	assert.Equal(t, 2, len(rs))
+	assert.NotEqual(t, rs[0].Name, rs[1].Name)
+
+	// the rules of other components are ignored
+	em, err = NewEventManagerWithSources([]ComponentType{ComponentPD}, RuleFile(other))
+	assert.Nil(t, err)
+	assert.Nil(t, em.GetRulesByEventID(29999))
+	em, err = NewEventManagerWithSources([]ComponentType{ComponentTiKV}, RuleFile(other))
+	assert.Nil(t, err)
+	assert.Equal(t, "custom tikv", em.GetRulesByEventID(29999)[0].Name)
+
+	source, err = RuleReader("inline", strings.NewReader(`
+[[rule]]
+  id = 1
+  name = "inline"
+  [rule.patterns]
+    level = "INFO"
+    message = "inline"
+`))
+	assert.Nil(t, err)
+	em, err = NewEventManagerWithSources([]ComponentType{ComponentTiDB}, source)
+	assert.Nil(t, err)
+	assert.Equal(t, "inline", em.GetRulesByEventID(1)[0].Name)
+
+	_, err = RuleReader("bad", strings.NewReader(`component = "mysql"`))
+	assert.NotNil(t, err)
+	_, err = RuleReader("bad", strings.NewReader(`[[rule]`))
+	assert.NotNil(t, err)
+	_, err = NewEventManagerWithSources(nil, RuleFile(filepath.Join(dir, "missing.toml")))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/errors"
+)
+
+var placeholderRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// templateRegex returns the regex of a message template, eg.
+//
+//	region {region_id} split into {count}
+//
+// matches the whole message with a placeholder for any non-empty text, even
+// across lines, the text is captured by the name of the placeholder. The
+// braces not around a name are literal.
+func templateRegex(tmpl string) (string, error) {
+	var sb strings.Builder
+	names := make(map[string]bool)
+	sb.WriteString("(?s)^")
+	last := 0
+	for _, loc := range placeholderRegex.FindAllStringSubmatchIndex(tmpl, -1) {
+		name := tmpl[loc[2]:loc[3]]
+		if names[name] {
+			return "", errors.Errorf("duplicate placeholder {%s} in template '%s'", name, tmpl)
+		}
+		names[name] = true
+		sb.WriteString(regexp.QuoteMeta(tmpl[last:loc[0]]))
+		sb.WriteString("(?P<" + name + ">.+?)")
+		last = loc[1]
+	}
+	sb.WriteString(regexp.QuoteMeta(tmpl[last:]))
+	sb.WriteString("$")
+	return sb.String(), nil
+}
+
+// messageRegex returns the regex of the message of regex and template mode,
+// ok is false for the other modes.
+func (r *Rule) messageRegex() (expr string, ok bool, err error) {
+	switch r.MessageMode() {
+	case MessageModeRegex:
+		return r.Patterns.Message, true, nil
+	case MessageModeTemplate:
+		expr, err := templateRegex(r.Patterns.Message)
+		return expr, true, err
+	}
+	return "", false, nil
+}
+
+// captures returns the text captured by the named groups of the regex, the
+// groups not taking part in the match are left out.
+func captures(regex *regexp.Regexp, s string) map[string]string {
+	params := make(map[string]string)
+	if regex.NumSubexp() == 0 {
+		return params
+	}
+	loc := regex.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return params
+	}
+	for i, name := range regex.SubexpNames() {
+		if i > 0 && name != "" && loc[2*i] >= 0 {
+			params[name] = s[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return params
+}
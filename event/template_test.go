@@ -0,0 +1,94 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateRegex(t *testing.T) {
+	expr, err := templateRegex("region {region_id} split into {count} (x{1})")
+	assert.Nil(t, err)
+	assert.Equal(t, `(?s)^region (?P<region_id>.+?) split into (?P<count>.+?) \(x\{1\}\)$`, expr)
+
+	// a placeholder matches the text across lines
+	expr, err = templateRegex("panic {what}")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"what": "a\nb"}, captures(regexp.MustCompile(expr), "panic a\nb"))
+	assert.Equal(t, "panic ", requiredLiteral(expr))
+	em, err := newEventManager([]*Rule{{
+		ID:       1,
+		Patterns: RulePattern{Level: "ERROR", Message: "panic {what}", MessageMode: "template"},
+	}})
+	assert.Nil(t, err)
+	e := em.Match(&parser.LogEntry{Header: parser.LogHeader{Level: parser.LogLevelError}, Message: "panic a\nb"})
+	assert.NotNil(t, e)
+	assert.Equal(t, "a\nb", e.Params["what"])
+
+	_, err = templateRegex("{a} and {a}")
+	assert.NotNil(t, err)
+}
+
+func TestMatch(t *testing.T) {
+	em, err := newEventManager([]*Rule{{
+		ID: 1,
+		Patterns: RulePattern{
+			Level:       "INFO",
+			Message:     "region {region_id} split into {count}",
+			MessageMode: "template",
+		},
+	}, {
+		ID: 2,
+		Patterns: RulePattern{
+			Level:       "INFO",
+			Message:     `^load region (?P<region_id>\d+)( from (?P<store>\S+))?$`,
+			MessageMode: "regex",
+		},
+	}, {
+		ID: 3,
+		Patterns: RulePattern{
+			Level:   "INFO",
+			Message: "welcome",
+		},
+	}})
+	assert.Nil(t, err)
+
+	log := func(msg string, fields ...parser.LogField) *parser.LogEntry {
+		return &parser.LogEntry{Header: parser.LogHeader{Level: parser.LogLevelInfo}, Message: msg, Fields: fields}
+	}
+	e := em.Match(log("region 42 split into 3", parser.LogField{Name: "count", Value: "x"}, parser.LogField{Name: "cost", Value: "1s"}))
+	assert.Equal(t, uint(1), e.Rule.ID)
+	assert.Equal(t, map[string]string{"region_id": "42", "count": "3", "cost": "1s"}, e.Params)
+
+	e = em.Match(log("load region 7 from 127.0.0.1:20160"))
+	assert.Equal(t, uint(2), e.Rule.ID)
+	assert.Equal(t, map[string]string{"region_id": "7", "store": "127.0.0.1:20160"}, e.Params)
+	e = em.Match(log("load region 7"))
+	assert.Equal(t, map[string]string{"region_id": "7"}, e.Params)
+
+	e = em.Match(log("welcome", parser.LogField{Name: "version", Value: "v5.0.0"}))
+	assert.Equal(t, uint(3), e.Rule.ID)
+	assert.Equal(t, map[string]string{"version": "v5.0.0"}, e.Params)
+
+	assert.Nil(t, em.Match(log("region 42 split")))
+	assert.Equal(t, uint(1), em.GetLogEventID(log("region 1 split into 2")))
+
+	_, err = newEventManager([]*Rule{{ID: 1, Patterns: RulePattern{Message: "{a} {a}", MessageMode: "template"}}})
+	assert.NotNil(t, err)
+}
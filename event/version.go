@@ -0,0 +1,283 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/pingcap/errors"
+)
+
+// version is a release version like v5.0.0, v5.0.0-rc or the one built from
+// a commit like v4.0.0-beta.2-1120-g2d9ba45.
+type version struct {
+	major, minor, patch int
+	// pre is the pre-release after the '-' like rc.2, a version with it is
+	// before the one without it.
+	pre string
+	// commits is the number of commits after the tag in the suffix of git
+	// describe like -1120-g2d9ba45, the build is after the tag.
+	commits int
+}
+
+var (
+	versionRegex  = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-(\S+))?$`)
+	describeRegex = regexp.MustCompile(`^(?:(.*)-)?(\d+)-g[0-9a-f]+$`)
+)
+
+func parseVersion(s string) (version, error) {
+	m := versionRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return version{}, errors.Errorf("invalid version '%s'", s)
+	}
+	v := version{pre: m[4]}
+	v.major, _ = strconv.Atoi(m[1])
+	v.minor, _ = strconv.Atoi(m[2])
+	v.patch, _ = strconv.Atoi(m[3])
+	if d := describeRegex.FindStringSubmatch(v.pre); d != nil {
+		v.pre = d[1]
+		v.commits, _ = strconv.Atoi(d[2])
+	}
+	return v, nil
+}
+
+// compare returns -1, 0 or 1 if v is before, the same as or after w.
+func (v version) compare(w version) int {
+	for _, d := range []int{v.major - w.major, v.minor - w.minor, v.patch - w.patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.pre == w.pre:
+	case v.pre == "":
+		return 1
+	case w.pre == "":
+		return -1
+	default:
+		if c := comparePrerelease(v.pre, w.pre); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case v.commits < w.commits:
+		return -1
+	case v.commits > w.commits:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares the pre-releases like semver, ie. the
+// identifiers separated by '.' one by one, the numeric ones numerically and
+// before the others, and a prefix is before the longer one, eg.
+// alpha < alpha.1 < beta < rc.2 < rc.10.
+func comparePrerelease(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				if an < bn {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		case as[i] != bs[i]:
+			if as[i] < bs[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(as) < len(bs):
+		return -1
+	case len(as) > len(bs):
+		return 1
+	}
+	return 0
+}
+
+// versionRange is the versions [min, max) a rule applies to, a nil bound
+// is unbounded.
+type versionRange struct {
+	min, max *version
+}
+
+func (r *Rule) versionRange() (versionRange, error) {
+	vr := versionRange{}
+	if r.MinVersion != "" {
+		v, err := parseVersion(r.MinVersion)
+		if err != nil {
+			return vr, errors.Annotatef(err, "min_version of rule %d (%s)", r.ID, r.Name)
+		}
+		vr.min = &v
+	}
+	if r.MaxVersion != "" {
+		v, err := parseVersion(r.MaxVersion)
+		if err != nil {
+			return vr, errors.Annotatef(err, "max_version of rule %d (%s)", r.ID, r.Name)
+		}
+		vr.max = &v
+	}
+	if vr.min != nil && vr.max != nil && vr.min.compare(*vr.max) >= 0 {
+		return vr, errors.Errorf("empty version range [%s, %s) of rule %d (%s)", r.MinVersion, r.MaxVersion, r.ID, r.Name)
+	}
+	return vr, nil
+}
+
+func (vr versionRange) contains(v version) bool {
+	return (vr.min == nil || vr.min.compare(v) <= 0) && (vr.max == nil || v.compare(*vr.max) < 0)
+}
+
+// versionFields are the fields of the startup banners telling the version.
+var versionFields = []string{"Release Version", "release-version"}
+
+// DetectVersion returns the release version in the startup banner, eg.
+//
+//	["Welcome to TiDB."] ["Release Version"=v5.0.0] ...
+//	["PD"] [release-version=v5.0.0] ...
+//	["Release Version:   5.0.0"]
+//
+// ok is false if the log isn't a banner.
+func DetectVersion(l *parser.LogEntry) (v string, ok bool) {
+	for _, f := range l.Fields {
+		for _, name := range versionFields {
+			if f.Name == name {
+				return strings.TrimSpace(f.Value), true
+			}
+		}
+	}
+	if strings.HasPrefix(l.Message, "Release Version:") {
+		return strings.TrimSpace(strings.TrimPrefix(l.Message, "Release Version:")), true
+	}
+	return "", false
+}
+
+// ForVersion returns the *EventManager with the rules applying to the
+// version, ie. the ones whose min_version <= version < max_version. The
+// managers are cached by the rules applying, so it's cheap to call it for
+// every log, and the cache is bounded by the number of the version bounds
+// of the rules however many versions are asked.
+func (em *EventManager) ForVersion(v string) (*EventManager, error) {
+	parsed, err := parseVersion(v)
+	if err != nil {
+		return nil, err
+	}
+	rs := []*Rule{}
+	key := make([]byte, len(em.rules))
+	for i, r := range em.rules {
+		key[i] = '0'
+		if em.ranges[i].contains(parsed) {
+			key[i] = '1'
+			rs = append(rs, r)
+		}
+	}
+	em.versionsMu.Lock()
+	defer em.versionsMu.Unlock()
+	if vem, ok := em.versions[string(key)]; ok {
+		return vem, nil
+	}
+	vem, err := newEventManager(rs)
+	if err != nil {
+		return nil, err
+	}
+	em.versions[string(key)] = vem
+	return vem, nil
+}
+
+// VersionScope matches the logs of a stream, eg. a log file, with the rules
+// applying to the version in the latest startup banner, see DetectVersion.
+// All the rules are used before the first banner or if the version in it
+// is unknown, eg. a build from a branch. It's not safe for concurrent use.
+type VersionScope struct {
+	em      *EventManager
+	current *EventManager
+	version string
+}
+
+func NewVersionScope(em *EventManager) *VersionScope {
+	return &VersionScope{em: em, current: em}
+}
+
+// Observe picks up the version if the log is a startup banner, the logs
+// must be observed in order. The matching methods of VersionScope observe
+// the log themselves.
+func (s *VersionScope) Observe(l *parser.LogEntry) {
+	v, ok := DetectVersion(l)
+	if !ok || v == s.version {
+		return
+	}
+	s.version = v
+	if vem, err := s.em.ForVersion(v); err == nil {
+		s.current = vem
+	} else {
+		s.current = s.em
+	}
+}
+
+// Version returns the version in the latest banner, it's empty if there is
+// none.
+func (s *VersionScope) Version() string {
+	return s.version
+}
+
+// EventManager returns the *EventManager of the current version.
+func (s *VersionScope) EventManager() *EventManager {
+	return s.current
+}
+
+func (s *VersionScope) GetRuleByLog(l *parser.LogEntry) *Rule {
+	s.Observe(l)
+	return s.current.GetRuleByLog(l)
+}
+
+func (s *VersionScope) GetAllRulesByLog(l *parser.LogEntry) []*Rule {
+	s.Observe(l)
+	return s.current.GetAllRulesByLog(l)
+}
+
+func (s *VersionScope) GetLogEventID(l *parser.LogEntry) uint {
+	s.Observe(l)
+	return s.current.GetLogEventID(l)
+}
+
+func (s *VersionScope) GuessLogEventID(l *parser.LogEntry, n int) []uint {
+	s.Observe(l)
+	return s.current.GuessLogEventID(l, n)
+}
+
+func (s *VersionScope) Match(l *parser.LogEntry) *Event {
+	s.Observe(l)
+	return s.current.Match(l)
+}
+
+// GetRulesByEventID returns the rules of the id of all the versions.
+func (s *VersionScope) GetRulesByEventID(id uint) []*Rule {
+	return s.em.GetRulesByEventID(id)
+}
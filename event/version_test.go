@@ -0,0 +1,118 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package event
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionCompare(t *testing.T) {
+	ordered := []string{
+		"v4.0.0-beta.2", "v4.0.0-beta.2-1120-g2d9ba45", "v4.0.0-rc", "4.0.0", "v4.0.16",
+		"v5.0.0-alpha", "v5.0.0-alpha.1", "v5.0.0-rc", "v5.0.0-rc.2", "v5.0.0-rc.10", "v5.0.0",
+		"v5.0.0-3-g0c0a2b1", "v5.0.0-12-g0c0a2b1", "v5.0.1", "v5.1.0", "v10.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			vi, err := parseVersion(ordered[i])
+			assert.Nil(t, err)
+			vj, err := parseVersion(ordered[j])
+			assert.Nil(t, err)
+			expected := 0
+			if i < j {
+				expected = -1
+			} else if i > j {
+				expected = 1
+			}
+			assert.Equal(t, expected, vi.compare(vj), "%s %s", ordered[i], ordered[j])
+		}
+	}
+	for _, v := range []string{"", "None", "v5.0", "master"} {
+		_, err := parseVersion(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestDetectVersion(t *testing.T) {
+	for v, l := range map[string]*parser.LogEntry{
+		"v5.0.0": {Message: "Welcome to TiDB.", Fields: []parser.LogField{{Name: "Release Version", Value: "v5.0.0"}}},
+		"v5.0.1": {Message: "PD", Fields: []parser.LogField{{Name: "release-version", Value: "v5.0.1"}}},
+		"5.0.2":  {Message: "Release Version:   5.0.2"},
+	} {
+		detected, ok := DetectVersion(l)
+		assert.True(t, ok)
+		assert.Equal(t, v, detected)
+	}
+	_, ok := DetectVersion(&parser.LogEntry{Message: "Welcome to TiDB."})
+	assert.False(t, ok)
+}
+
+func TestVersionScope(t *testing.T) {
+	rule := func(id uint, min, max string) *Rule {
+		return &Rule{ID: id, MinVersion: min, MaxVersion: max, Patterns: RulePattern{Level: "INFO", Message: "m"}}
+	}
+	em, err := newEventManager([]*Rule{rule(1, "v5.0.0", ""), rule(2, "v4.0.0", "v5.0.0"), rule(3, "", "")})
+	assert.Nil(t, err)
+	m := &parser.LogEntry{Header: parser.LogHeader{Level: parser.LogLevelInfo}, Message: "m"}
+	banner := func(v string) *parser.LogEntry {
+		return &parser.LogEntry{
+			Header:  parser.LogHeader{Level: parser.LogLevelInfo},
+			Message: "Welcome to TiDB.",
+			Fields:  []parser.LogField{{Name: "Release Version", Value: v}},
+		}
+	}
+
+	vem, err := em.ForVersion("v4.0.16")
+	assert.Nil(t, err)
+	assert.Equal(t, []*Rule{em.rules[1], em.rules[2]}, vem.GetAllRulesByLog(m))
+	cached, err := em.ForVersion("4.0.16")
+	assert.Nil(t, err)
+	assert.True(t, vem == cached)
+	// cached by the rules applying rather than the version
+	cached, err = em.ForVersion("v4.1.0")
+	assert.Nil(t, err)
+	assert.True(t, vem == cached)
+	for i := 0; i < 100; i++ {
+		_, err = em.ForVersion(fmt.Sprintf("v6.%d.0", i))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, len(em.versions))
+	_, err = em.ForVersion("None")
+	assert.NotNil(t, err)
+
+	s := NewVersionScope(em)
+	// all the rules before the banner
+	assert.Equal(t, uint(1), s.GetLogEventID(m))
+	assert.Equal(t, uint(0), s.GetLogEventID(banner("v4.0.0")))
+	assert.Equal(t, "v4.0.0", s.Version())
+	assert.Equal(t, uint(2), s.GetLogEventID(m))
+	assert.Equal(t, 2, len(s.GetAllRulesByLog(m)))
+	// restarted after upgrade
+	s.Observe(banner("v5.1.0"))
+	assert.Equal(t, uint(1), s.GetLogEventID(m))
+	assert.Equal(t, []*Rule{em.rules[0], em.rules[2]}, s.EventManager().GetAllRulesByLog(m))
+	// unknown version
+	s.Observe(banner("None"))
+	assert.Equal(t, 3, len(s.GetAllRulesByLog(m)))
+	// the rules of an ID of all the versions
+	assert.Equal(t, 1, len(s.GetRulesByEventID(2)))
+
+	_, err = newEventManager([]*Rule{rule(1, "v5", "")})
+	assert.NotNil(t, err)
+}
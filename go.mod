@@ -4,12 +4,14 @@ go 1.16
 
 require (
 	github.com/BurntSushi/toml v0.4.1
-	github.com/divan/gorilla-xmlrpc v0.0.0-20190926132722-f0686da74fda // indirect
-	github.com/gorilla/rpc v1.2.0 // indirect
+	github.com/divan/gorilla-xmlrpc v0.0.0-20190926132722-f0686da74fda
+	github.com/gorilla/rpc v1.2.0
 	github.com/hbollon/go-edlib v1.5.0
+	github.com/klauspost/compress v1.13.6
 	github.com/mattn/go-sqlite3 v1.14.9
-	github.com/pingcap/check v0.0.0-20211026125417-57bd13f7b5f0 // indirect
+	github.com/pingcap/check v0.0.0-20211026125417-57bd13f7b5f0
 	github.com/pingcap/errors v0.11.4
 	github.com/rogpeppe/go-charset v0.0.0-20190617161244-0dc95cdf6f31 // indirect
 	github.com/spf13/cobra v1.3.0
+	github.com/stretchr/testify v1.7.0
 )
@@ -2,10 +2,13 @@ package main
 
 import (
 	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/divan/gorilla-xmlrpc/xml"
@@ -18,39 +21,32 @@ type LogService struct {
 	ems map[event.ComponentType]*event.EventManager
 }
 
-func NewLogService() *LogService {
+// NewLogService creates the *LogService with the embedded rules extended by
+// the sources.
+func NewLogService(sources ...event.RuleSource) (*LogService, error) {
 	ls := &LogService{ems: make(map[event.ComponentType]*event.EventManager)}
-	tps := []event.ComponentType{
-		event.ComponentTiDB,
-		event.ComponentTiKV,
-		event.ComponentPD,
-		event.ComponentLightning,
-		event.ComponentTiFlash,
-	}
-	for _, tp := range tps {
-		em, err := event.NewEventManager(tp)
+	for _, tp := range event.AllComponentTypes() {
+		em, err := event.NewEventManagerWithSources([]event.ComponentType{tp}, sources...)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		ls.ems[tp] = em
 	}
-	return ls
+	return ls, nil
 }
 
 func (h *LogService) ID(
 	r *http.Request,
 	args *struct {
 		Component string
-		Log       []byte
+		// Version, if given, restricts the rules to the version
+		Version string
+		Log     []byte
 	},
 	reply *struct {
 		ID string
 	}) error {
 
-	ct, err := event.GetComponentType(args.Component)
-	if err != nil {
-		return err
-	}
 	ls, err := parser.ParseFromString(string(args.Log))
 	if err != nil {
 		return err
@@ -59,7 +55,11 @@ func (h *LogService) ID(
 		return errors.New("no valid logs provided")
 	}
 	l := ls[0]
-	em := h.ems[ct]
+	ct, err := componentOf(args.Component, ls)
+	if err != nil {
+		return err
+	}
+	em := h.eventManager(ct, args.Version)
 	rule := em.GetRuleByLog(l)
 	if rule != nil {
 		reply.ID = strconv.Itoa(int(rule.ID))
@@ -69,6 +69,29 @@ func (h *LogService) ID(
 	return nil
 }
 
+// eventManager returns the *event.EventManager of the component with the
+// rules of the version, or all the rules if the version is empty or unknown.
+func (h *LogService) eventManager(ct event.ComponentType, version string) *event.EventManager {
+	em := h.ems[ct]
+	if version == "" {
+		return em
+	}
+	if vem, err := em.ForVersion(version); err == nil {
+		return vem
+	}
+	return em
+}
+
+// componentOf returns the component given, or detected from all the logs
+// given if it's empty like the CLI, see event.DetectComponentOrDefault.
+func componentOf(component string, ls []*parser.LogEntry) (event.ComponentType, error) {
+	if component != "" {
+		return event.GetComponentType(component)
+	}
+	ct, _ := event.DetectComponentOrDefault(ls)
+	return ct, nil
+}
+
 type LogField struct {
 	Name  string
 	Value []byte
@@ -78,23 +101,30 @@ func (h *LogService) Parse(
 	r *http.Request,
 	args *struct {
 		Component string
-		Log       []byte
+		// Version, if given, restricts the rules to the version
+		Version string
+		Log     []byte
 	},
 	reply *struct {
-		ID       string
-		Name     string
-		Level    string
-		DateTime string
-		File     string
-		Line     string
-		Message  []byte
-		Fields   []LogField
+		ID        string
+		Name      string
+		Component string
+		Level     string
+		DateTime  string
+		File      string
+		Line      string
+		Message   []byte
+		Fields    []LogField
+
+		// the metadata of the rule
+		Severity    string
+		Category    string
+		Tags        []string
+		Description string
+		Remediation string
+		Links       []string
 	}) error {
 
-	ct, err := event.GetComponentType(args.Component)
-	if err != nil {
-		return err
-	}
 	ls, err := parser.ParseFromString(string(args.Log))
 	if err != nil {
 		return err
@@ -103,15 +133,28 @@ func (h *LogService) Parse(
 		return errors.New("no valid logs provided")
 	}
 	l := ls[0]
-	em := h.ems[ct]
+	ct, err := componentOf(args.Component, ls)
+	if err != nil {
+		return err
+	}
+	em := h.eventManager(ct, args.Version)
 	rule := em.GetRuleByLog(l)
+	reply.Tags = make([]string, 0)
+	reply.Links = make([]string, 0)
 	if rule != nil {
 		reply.ID = strconv.Itoa(int(rule.ID))
 		reply.Name = rule.Name
+		reply.Severity = rule.Severity
+		reply.Category = rule.Category
+		reply.Tags = append(reply.Tags, rule.Tags...)
+		reply.Description = rule.Description
+		reply.Remediation = rule.Remediation
+		reply.Links = append(reply.Links, rule.Links...)
 	} else {
 		reply.ID = "0"
 		reply.Name = ""
 	}
+	reply.Component = ct.String()
 	reply.Level = string(l.Header.Level)
 	reply.DateTime = l.Header.DateTime.Format(time.RFC3339)
 	reply.File = l.Header.File
@@ -127,13 +170,50 @@ func (h *LogService) Parse(
 	return nil
 }
 
+// pathsFlag is a flag given more than once.
+type pathsFlag []string
+
+func (f *pathsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *pathsFlag) Set(path string) error {
+	*f = append(*f, path)
+	return nil
+}
+
 func main() {
+	rules := pathsFlag{}
+	flag.Var(&rules, "rules", "the rule file or directory of *.toml extending the embedded rules, the later ones take precedence")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-rules path]... <port>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	sources := []event.RuleSource{}
+	for _, path := range rules {
+		source, err := event.RulePath(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		sources = append(sources, source)
+	}
+	service, err := NewLogService(sources...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	RPC := rpc.NewServer()
 	xmlrpcCodec := xml.NewCodec()
 	RPC.RegisterCodec(xmlrpcCodec, "text/xml")
-	RPC.RegisterService(NewLogService(), "")
+	RPC.RegisterService(service, "")
 	http.Handle("/RPC2", RPC)
 
-	port := os.Args[1]
+	port := flag.Arg(0)
 	log.Fatal(http.ListenAndServe("127.0.0.1:"+port, nil))
 }
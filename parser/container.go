@@ -0,0 +1,178 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"encoding/json"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ContainerMeta is the metadata of a log wrapped by the container runtime or
+// kubectl, the fields unknown from the envelope and the file name are empty.
+type ContainerMeta struct {
+	Pod       string
+	Container string
+	Stream    string    // "stdout" or "stderr"
+	Time      time.Time // the time the runtime received the log
+}
+
+// The envelopes recognized in container mode:
+//
+//	CRI:              2021-12-13T12:41:00.755Z stdout F [2021/12/13 ...] ...
+//	Docker json-file: {"log":"[2021/12/13 ...] ...\n","stream":"stdout","time":"2021-12-13T12:41:00.755Z"}
+//	kubectl --prefix: [pod/tidb-0/tidb] [2021/12/13 ...] ...
+//
+// A CRI line tagged P and a Docker line without the trailing '\n' are partial,
+// they're joined with the following ones until the full line.
+
+// WithContainer makes the parser unwrap the lines in the envelopes of CRI,
+// Docker json-file and `kubectl logs --prefix`, and fill the Container of
+// every LogEntry. The lines without envelope are parsed as usual. For the
+// files in the layout of /var/log/pods and /var/log/containers, the pod and
+// container are taken from the file name.
+func (sp *StreamParser) WithContainer() *StreamParser {
+	sp.containers = true
+	return sp
+}
+
+// unwrap removes the envelope of the line and joins the partial lines.
+func (sp *StreamParser) unwrap(line *rawLine) *rawLine {
+	text, meta, partial := unwrapContainer(line.text)
+	if meta == nil {
+		return line
+	}
+	for partial {
+		next := sp.scanLine()
+		if next == nil {
+			break
+		}
+		var more string
+		more, _, partial = unwrapContainer(next.text)
+		if room := sp.maxLineSize - len(text); len(more) > room {
+			if room < 0 {
+				room = 0
+			}
+			more = more[:room]
+			line.truncated = true
+		}
+		text += more
+		line.truncated = line.truncated || next.truncated
+	}
+	if meta.Pod == "" {
+		meta.Pod, meta.Container = sp.sourceContainer()
+	}
+	line.text = text
+	line.container = meta
+	return line
+}
+
+// sourceContainer returns the pod and container of the current input.
+func (sp *StreamParser) sourceContainer() (string, string) {
+	if sp.podSource != sp.Source {
+		sp.podSource = sp.Source
+		sp.pod, sp.container = containerFromPath(sp.Source)
+	}
+	return sp.pod, sp.container
+}
+
+// unwrapContainer returns the content of the line in an envelope, the meta
+// is nil if the line is not wrapped.
+func unwrapContainer(line string) (string, *ContainerMeta, bool) {
+	switch {
+	case strings.HasPrefix(line, "[pod/"):
+		return unwrapKubectl(line)
+	case strings.HasPrefix(line, `{"log":`):
+		return unwrapDocker(line)
+	case len(line) > 20 && line[4] == '-' && line[10] == 'T':
+		return unwrapCRI(line)
+	}
+	return line, nil, false
+}
+
+// unwrapKubectl unwraps "[pod/<pod>/<container>] <content>".
+func unwrapKubectl(line string) (string, *ContainerMeta, bool) {
+	end := strings.Index(line, "] ")
+	if end < 0 {
+		return line, nil, false
+	}
+	xs := strings.SplitN(line[len("[pod/"):end], "/", 2)
+	if len(xs) != 2 {
+		return line, nil, false
+	}
+	return line[end+2:], &ContainerMeta{Pod: xs[0], Container: xs[1]}, false
+}
+
+// unwrapDocker unwraps a line of the json-file logging driver.
+func unwrapDocker(line string) (string, *ContainerMeta, bool) {
+	var envelope struct {
+		Log    string    `json:"log"`
+		Stream string    `json:"stream"`
+		Time   time.Time `json:"time"`
+	}
+	if err := json.Unmarshal([]byte(line), &envelope); err != nil {
+		return line, nil, false
+	}
+	text := strings.TrimSuffix(envelope.Log, "\n")
+	partial := len(text) == len(envelope.Log)
+	text = strings.TrimSuffix(text, "\r")
+	return text, &ContainerMeta{Stream: envelope.Stream, Time: envelope.Time}, partial
+}
+
+// unwrapCRI unwraps "<time> <stream> <tag> <content>", the tag is P for a
+// partial line and F for a full one, more attributes may follow it after ':'.
+func unwrapCRI(line string) (string, *ContainerMeta, bool) {
+	xs := strings.SplitN(line, " ", 4)
+	if len(xs) < 3 || (xs[1] != "stdout" && xs[1] != "stderr") {
+		return line, nil, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, xs[0])
+	if err != nil {
+		return line, nil, false
+	}
+	tag := strings.SplitN(xs[2], ":", 2)[0]
+	if tag != "P" && tag != "F" {
+		return line, nil, false
+	}
+	text := ""
+	if len(xs) == 4 {
+		text = xs[3]
+	}
+	return text, &ContainerMeta{Stream: xs[1], Time: t}, tag == "P"
+}
+
+// containerFromPath returns the pod and container of a log file in the
+// layout of kubelet:
+//
+//	/var/log/pods/<namespace>_<pod>_<uid>/<container>/<n>.log
+//	/var/log/containers/<pod>_<namespace>_<container>-<id>.log
+func containerFromPath(source string) (string, string) {
+	dir, file := path.Split(filepath.ToSlash(source))
+	dir = path.Clean(dir)
+	if parent := path.Base(path.Dir(dir)); strings.Count(parent, "_") == 2 && path.Base(path.Dir(path.Dir(dir))) == "pods" {
+		return strings.Split(parent, "_")[1], path.Base(dir)
+	}
+	if path.Base(dir) == "containers" {
+		xs := strings.Split(strings.TrimSuffix(file, ".log"), "_")
+		if len(xs) == 3 {
+			if i := strings.LastIndex(xs[2], "-"); i > 0 {
+				return xs[0], xs[2][:i]
+			}
+		}
+	}
+	return "", ""
+}
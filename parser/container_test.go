@@ -0,0 +1,102 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainer(t *testing.T) {
+	logtxt := strings.Join([]string{
+		`2021-12-13T12:41:00.755Z stdout F [2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [cri]`,
+		`2021-12-13T12:41:00.756Z stderr P [2021/12/13 20:41:00.756 +08:00] [INFO] [a.go:1] [part`,
+		`2021-12-13T12:41:00.756Z stderr P ial]`,
+		`2021-12-13T12:41:00.756Z stderr F  [k=v]`,
+		`{"log":"[2021/12/13 20:41:00.757 +08:00] [WARN] [a.go:1] [docker]\n","stream":"stdout","time":"2021-12-13T12:41:00.757Z"}`,
+		`{"log":"[2021/12/13 20:41:00.758 +08:00] [WARN] [a.go:1] [docker ","stream":"stdout","time":"2021-12-13T12:41:00.758Z"}`,
+		`{"log":"partial]\n","stream":"stdout","time":"2021-12-13T12:41:00.758Z"}`,
+		`[pod/tidb-0/tidb] [2021/12/13 20:41:00.759 +08:00] [ERROR] [a.go:1] [kubectl]`,
+		`[2021/12/13 20:41:00.760 +08:00] [INFO] [a.go:1] [plain]`,
+	}, "\n")
+	// the envelopes are not recognized by default
+	_, err := ParseFromString(logtxt)
+	assert.NotNil(t, err)
+
+	sp := NewStreamParser(strings.NewReader(logtxt)).WithSource("/var/log/pods/tidb_basic-tidb-0_0a1b/tidb/0.log").WithContainer()
+	logs, _, err := sp.ReadAll()
+	assert.Nil(t, err)
+	msgs := []string{}
+	for _, l := range logs {
+		msgs = append(msgs, l.Message)
+	}
+	assert.Equal(t, []string{"cri", "partial", "docker", "docker partial", "kubectl", "plain"}, msgs)
+	assert.Equal(t, &ContainerMeta{
+		Pod:       "basic-tidb-0",
+		Container: "tidb",
+		Stream:    "stderr",
+		Time:      time.Date(2021, 12, 13, 12, 41, 0, 756000000, time.UTC),
+	}, logs[1].Container)
+	assert.Equal(t, []LogField{{"k", "v"}}, logs[1].Fields)
+	assert.Equal(t, 2, logs[1].Position.Line)
+	assert.Equal(t, 6, logs[3].Position.Line)
+	assert.Equal(t, "stdout", logs[3].Container.Stream)
+	assert.Equal(t, &ContainerMeta{Pod: "tidb-0", Container: "tidb"}, logs[4].Container)
+	assert.Nil(t, logs[5].Container)
+}
+
+func TestContainerFromPath(t *testing.T) {
+	for path, expected := range map[string][2]string{
+		"/var/log/pods/tidb_basic-tidb-0_0a1b/tidb/0.log":                       {"basic-tidb-0", "tidb"},
+		"/var/log/containers/basic-tikv-1_tidb_tikv-0123456789abcdef.log":       {"basic-tikv-1", "tikv"},
+		"/var/log/containers/basic-pd-0_tidb_slowlog-tail-0123456789abcdef.log": {"basic-pd-0", "slowlog-tail"},
+		"/tmp/tidb.log": {"", ""},
+	} {
+		pod, container := containerFromPath(path)
+		assert.Equal(t, expected, [2]string{pod, container}, path)
+	}
+}
+
+func TestParallelParserContainer(t *testing.T) {
+	buf := strings.Builder{}
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&buf, "2021-12-13T12:41:00.755Z stdout P [2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [%d\n", i)
+		fmt.Fprintf(&buf, "2021-12-13T12:41:00.755Z stdout P %s\n", strings.Repeat("x", i%50))
+		fmt.Fprintf(&buf, "2021-12-13T12:41:00.755Z stdout F ]\n")
+		if i%10 == 0 {
+			fmt.Fprintf(&buf, "2021-12-13T12:41:00.755Z stderr F goroutine 1 [running]:\n")
+		}
+	}
+	input := buf.String()
+	for _, multiline := range []bool{false, true} {
+		config := func(sp *StreamParser) *StreamParser {
+			sp = sp.WithContainer().Lenient()
+			if multiline {
+				sp = sp.WithMultiline(0)
+			}
+			return sp
+		}
+		expected, _, err := config(NewStreamParser(strings.NewReader(input))).ReadAll()
+		assert.Nil(t, err)
+		assert.Equal(t, 500, len(expected))
+		logs, _, err := NewParallelParser(strings.NewReader(input), int64(len(input))).WithChunkSize(1000).WithConfig(config).ReadAll()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, logs)
+	}
+}
@@ -34,3 +34,72 @@ type UnexpectedTokenError struct {
 func (e *UnexpectedTokenError) Error() string {
 	return fmt.Sprintf("expect token '%s', got '%s'", e.ExpectedToken, e.GotToken)
 }
+
+// ParseError indicates a malformed log line and where the problem is.
+// The underlying error is one of UnexpectedEOLError, UnexpectedTokenError
+// or the error of converting a token (eg. the datetime).
+type ParseError struct {
+	Source string // eg. the file name, empty if unknown
+	Line   int    // 1-based line number, 0 if unknown
+	Offset int64  // byte offset of the offending token in the input
+	Column int    // 1-based byte column of the offending token in the line
+	Token  string // the offending token, empty if the line ends unexpectedly
+	Raw    string // the raw line
+	// Truncated tells if the line is longer than the max line size, only
+	// the beginning of it is in Raw.
+	Truncated bool
+	Err       error
+}
+
+func (e *ParseError) Error() string {
+	at := fmt.Sprintf("at line %d, column %d", e.Line, e.Column)
+	if e.Line == 0 {
+		at = fmt.Sprintf("at column %d", e.Column)
+	}
+	if e.Source != "" {
+		at = e.Source + " " + at
+	}
+	return fmt.Sprintf("%s: %s", at, e.Err)
+}
+
+// Cause returns the underlying error.
+func (e *ParseError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// FieldNotFoundError indicates the log has no field with the name.
+type FieldNotFoundError struct {
+	Name string
+}
+
+func (e *FieldNotFoundError) Error() string {
+	return fmt.Sprintf("field '%s' not found", e.Name)
+}
+
+// FieldConversionError indicates the value of a field can't be converted
+// to the requested type.
+type FieldConversionError struct {
+	Name  string
+	Value string
+	Type  string // eg. "int", "duration"
+	Err   error
+}
+
+func (e *FieldConversionError) Error() string {
+	return fmt.Sprintf("convert field '%s' value '%s' to %s: %s", e.Name, e.Value, e.Type, e.Err)
+}
+
+// Cause returns the underlying error.
+func (e *FieldConversionError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldConversionError) Unwrap() error {
+	return e.Err
+}
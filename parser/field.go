@@ -0,0 +1,428 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Get returns the value of the first field with the name. A name may
+// appear more than once in one log, use GetAll to get all the values.
+func (e *LogEntry) Get(name string) (string, bool) {
+	for _, f := range e.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// GetAll returns the values of all the fields with the name in order.
+func (e *LogEntry) GetAll(name string) []string {
+	var values []string
+	for _, f := range e.Fields {
+		if f.Name == name {
+			values = append(values, f.Value)
+		}
+	}
+	return values
+}
+
+// Has tells if the log has a field with the name.
+func (e *LogEntry) Has(name string) bool {
+	_, ok := e.Get(name)
+	return ok
+}
+
+// The typed accessors below convert the value of the first field with the
+// name. They return a *FieldNotFoundError if there is no such field and a
+// *FieldConversionError if the value can't be converted.
+
+// Int returns the field value as an integer.
+func (e *LogEntry) Int(name string) (int64, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, convertError(name, v, "int", err)
+	}
+	return i, nil
+}
+
+// Uint returns the field value as an unsigned integer.
+func (e *LogEntry) Uint(name string) (uint64, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, convertError(name, v, "uint", err)
+	}
+	return i, nil
+}
+
+// Float returns the field value as a float.
+func (e *LogEntry) Float(name string) (float64, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, convertError(name, v, "float", err)
+	}
+	return f, nil
+}
+
+// Bool returns the field value as a boolean, it accepts the forms of
+// strconv.ParseBool.
+func (e *LogEntry) Bool(name string) (bool, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return false, err
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, convertError(name, v, "bool", err)
+	}
+	return b, nil
+}
+
+// Duration returns the field value as a duration, eg. "1.5s", "1h2m" or
+// "1m 30s" printed by TiKV.
+func (e *LogEntry) Duration(name string) (time.Duration, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(strings.Join(strings.Fields(v), ""))
+	if err != nil {
+		return 0, convertError(name, v, "duration", err)
+	}
+	return d, nil
+}
+
+// ByteSize returns the field value as a number of bytes, see ParseByteSize.
+func (e *LogEntry) ByteSize(name string) (uint64, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	n, err := ParseByteSize(v)
+	if err != nil {
+		return 0, convertError(name, v, "byte size", err)
+	}
+	return n, nil
+}
+
+// Time returns the field value as a time, the layouts of DefaultTimeLayouts
+// are accepted and the ones without timezone are parsed in time.Local.
+func (e *LogEntry) Time(name string) (time.Time, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := defaultTimeParser().parse(v)
+	if err != nil {
+		return time.Time{}, convertError(name, v, "time", err)
+	}
+	return t, nil
+}
+
+// TSO returns the field value as a TSO.
+func (e *LogEntry) TSO(name string) (TSO, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	tso, err := ParseTSO(v)
+	if err != nil {
+		return 0, convertError(name, v, "tso", err)
+	}
+	return tso, nil
+}
+
+// Object returns the field value decoded as a nested value, see ParseObject.
+func (e *LogEntry) Object(name string) (interface{}, error) {
+	v, err := e.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := ParseObject(v)
+	if err != nil {
+		return nil, convertError(name, v, "object", err)
+	}
+	return obj, nil
+}
+
+func (e *LogEntry) lookup(name string) (string, error) {
+	v, ok := e.Get(name)
+	if !ok {
+		return "", &FieldNotFoundError{Name: name}
+	}
+	return v, nil
+}
+
+func convertError(name, value, typ string, err error) error {
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	return &FieldConversionError{
+		Name:  name,
+		Value: value,
+		Type:  typ,
+		Err:   err,
+	}
+}
+
+var byteUnits = map[string]uint64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+	"P": 1 << 50,
+}
+
+// ParseByteSize parses a byte size like "1.2GiB", "512MB" or "1024". As in
+// the configurations of TiDB and TiKV, the units are powers of 1024 whether
+// they're written as KiB or KB, and they're case-insensitive.
+func ParseByteSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= '0' && r <= '9' || r == '.')
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	num, unit := s[:i], strings.ToUpper(strings.TrimSpace(s[i:]))
+	if num == "" {
+		return 0, errors.New("missing number")
+	}
+	if u := strings.TrimSuffix(unit, "B"); u != unit {
+		if len(u) == 2 && u[1] == 'I' {
+			u = u[:1]
+		}
+		unit = u
+	}
+	scale, ok := byteUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit '%s'", s[i:])
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, err
+	}
+	size := f * float64(scale)
+	if size >= math.MaxUint64 {
+		return 0, strconv.ErrRange
+	}
+	return uint64(size), nil
+}
+
+// TSO is a timestamp allocated by PD, which consists of a physical time in
+// milliseconds and a logical counter.
+type TSO uint64
+
+const tsoLogicalBits = 18
+
+// ParseTSO parses a TSO printed as a decimal integer.
+func ParseTSO(s string) (TSO, error) {
+	tso, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return TSO(tso), nil
+}
+
+// Physical returns the physical time of the TSO.
+func (tso TSO) Physical() time.Time {
+	ms := int64(tso >> tsoLogicalBits)
+	return time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+}
+
+// Logical returns the logical counter of the TSO.
+func (tso TSO) Logical() int64 {
+	return int64(tso & (1<<tsoLogicalBits - 1))
+}
+
+// ParseObject decodes a nested value, either JSON, eg. the config of
+// "loaded config", or printed by the %v or %+v verbs of Go's fmt, eg.
+// "{ID:1 Peers:[2 3]}", "&{1 2}" and "map[a:1 b:2]". JSON objects and
+// arrays become map[string]interface{} and []interface{} with numbers as
+// json.Number. Go structs with field names and maps become
+// map[string]interface{}, slices and structs without field names become
+// []interface{}, and the other values are kept as strings.
+func ParseObject(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+	if json.Valid([]byte(s)) {
+		dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	p := objectParser{s: s}
+	v, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.s) {
+		return nil, p.errorf("unexpected '%c'", p.s[p.pos])
+	}
+	return v, nil
+}
+
+// objectParser parses the values printed by the %v and %+v verbs.
+type objectParser struct {
+	s   string
+	pos int
+}
+
+func (p *objectParser) value() (interface{}, error) {
+	if strings.HasPrefix(p.s[p.pos:], "&{") {
+		p.pos++
+	}
+	switch {
+	case strings.HasPrefix(p.s[p.pos:], "map["):
+		p.pos += len("map[")
+		return p.members(']', true)
+	case strings.HasPrefix(p.s[p.pos:], "{"):
+		p.pos++
+		return p.members('}', false)
+	case strings.HasPrefix(p.s[p.pos:], "["):
+		p.pos++
+		return p.list()
+	default:
+		return p.scalar(), nil
+	}
+}
+
+// members parses the members of a struct or map until the closing byte,
+// the keys are required for maps and optional for structs.
+func (p *objectParser) members(end byte, isMap bool) (interface{}, error) {
+	var keys []string
+	var values []interface{}
+	named := isMap
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("expect '%c', got end of value", end)
+		}
+		if p.s[p.pos] == end {
+			p.pos++
+			break
+		}
+		if p.s[p.pos] == ']' || p.s[p.pos] == '}' {
+			return nil, p.errorf("unexpected '%c'", p.s[p.pos])
+		}
+		key, ok := p.key(isMap)
+		if len(values) == 0 && !isMap {
+			named = ok
+		}
+		if ok != named {
+			return nil, p.errorf("mixed named and unnamed members")
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, v)
+	}
+	if !named {
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, nil
+	}
+	obj := make(map[string]interface{}, len(keys))
+	for i, k := range keys {
+		obj[k] = values[i]
+	}
+	return obj, nil
+}
+
+// key parses "key:" if it's there, the key of a struct must be an
+// identifier while the key of a map is anything before the colon.
+func (p *objectParser) key(isMap bool) (string, bool) {
+	i := p.pos
+	for i < len(p.s) && p.s[i] != ':' && !strings.ContainsRune(" []{}", rune(p.s[i])) {
+		if !isMap && !(p.s[i] == '_' || unicode.IsLetter(rune(p.s[i])) || unicode.IsDigit(rune(p.s[i]))) {
+			return "", false
+		}
+		i++
+	}
+	if i == p.pos || i >= len(p.s) || p.s[i] != ':' {
+		return "", false
+	}
+	key := p.s[p.pos:i]
+	p.pos = i + 1
+	return key, true
+}
+
+func (p *objectParser) list() (interface{}, error) {
+	values := []interface{}{}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.s) {
+			return nil, p.errorf("expect ']', got end of value")
+		}
+		if p.s[p.pos] == ']' {
+			p.pos++
+			return values, nil
+		}
+		if p.s[p.pos] == '}' {
+			return nil, p.errorf("unexpected '}'")
+		}
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+}
+
+// scalar parses a value until a space or a closing bracket.
+func (p *objectParser) scalar() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" ]}", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *objectParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *objectParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
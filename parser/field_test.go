@@ -0,0 +1,113 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldLookup(t *testing.T) {
+	logs, err := ParseFromString(`[2021/12/13 20:41:00.755 +08:00] [INFO] [ddl.go:1] [msg] [jobID=42] [region=1] [region=2] ["cost time"=1.5s] [mem=1.2GiB] [ok=true] [startTS=429758679811096577] [at="2021/12/13 20:41:00.755 +08:00"] [ratio=0.5] [config="{\"host\":\"0.0.0.0\",\"port\":4000}"]`)
+	assert.Nil(t, err)
+	log := logs[0]
+
+	v, ok := log.Get("region")
+	assert.True(t, ok)
+	assert.Equal(t, "1", v)
+	assert.Equal(t, []string{"1", "2"}, log.GetAll("region"))
+	assert.True(t, log.Has("jobID"))
+	assert.False(t, log.Has("missing"))
+	assert.Nil(t, log.GetAll("missing"))
+
+	i, err := log.Int("jobID")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), i)
+	u, err := log.Uint("jobID")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(42), u)
+	f, err := log.Float("ratio")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, f)
+	d, err := log.Duration("cost time")
+	assert.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, d)
+	n, err := log.ByteSize("mem")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1288490188), n)
+	b, err := log.Bool("ok")
+	assert.Nil(t, err)
+	assert.True(t, b)
+	tm, err := log.Time("at")
+	assert.Nil(t, err)
+	assert.True(t, tm.Equal(log.Header.DateTime))
+	tso, err := log.TSO("startTS")
+	assert.Nil(t, err)
+	assert.Equal(t, "2021-12-13T12:41:00.754Z", tso.Physical().UTC().Format("2006-01-02T15:04:05.000Z"))
+	assert.Equal(t, int64(1), tso.Logical())
+	obj, err := log.Object("config")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"host": "0.0.0.0", "port": json.Number("4000")}, obj)
+
+	_, err = log.Int("missing")
+	assert.Equal(t, &FieldNotFoundError{Name: "missing"}, err)
+	_, err = log.Int("mem")
+	assert.IsType(t, &FieldConversionError{}, err)
+	assert.Equal(t, "convert field 'mem' value '1.2GiB' to int: invalid syntax", err.Error())
+	_, err = log.Duration("mem")
+	assert.IsType(t, &FieldConversionError{}, err)
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, expected := range map[string]uint64{
+		"1024":   1024,
+		"10B":    10,
+		"1KB":    1024,
+		"1kib":   1024,
+		"1.5MiB": 1536 * 1024,
+		"2 GB":   2 << 30,
+		"1TiB":   1 << 40,
+	} {
+		n, err := ParseByteSize(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+	for _, s := range []string{"", "GiB", "1XB", "1.2.3MB", "1iB"} {
+		_, err := ParseByteSize(s)
+		assert.NotNil(t, err, s)
+	}
+}
+
+func TestParseObject(t *testing.T) {
+	for s, expected := range map[string]interface{}{
+		`[1,"a"]`:                    []interface{}{json.Number("1"), "a"},
+		`{ID:1 Peers:[2 3] Meta:{}}`: map[string]interface{}{"ID": "1", "Peers": []interface{}{"2", "3"}, "Meta": []interface{}{}},
+		`&{1 127.0.0.1:4000}`:        []interface{}{"1", "127.0.0.1:4000"},
+		`map[a:1 b:map[c:] d:[x y]]`: map[string]interface{}{"a": "1", "b": map[string]interface{}{"c": ""}, "d": []interface{}{"x", "y"}},
+		`{Addr:127.0.0.1:4000 Id:7}`: map[string]interface{}{"Addr": "127.0.0.1:4000", "Id": "7"},
+		`plain`:                      "plain",
+	} {
+		v, err := ParseObject(s)
+		assert.Nil(t, err, s)
+		assert.Equal(t, expected, v, s)
+	}
+	for _, s := range []string{`{a:1`, `[1 2}`, `{a:1 2}`, `map[a:1]]`} {
+		_, err := ParseObject(s)
+		assert.NotNil(t, err, s)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// DefaultFollowInterval is the default interval of polling the followed
+// file for new data.
+const DefaultFollowInterval = time.Second
+
+// FollowOptions are the options of FollowFile.
+type FollowOptions struct {
+	// FromStart makes the parser read the existing content of the file,
+	// otherwise it starts at the end of the file like `tail -F`.
+	FromStart bool
+	// Interval is the interval of polling, DefaultFollowInterval if zero.
+	Interval time.Duration
+}
+
+// FollowFile creates a *StreamParser which follows the file like `tail -F`:
+// it waits for new data at the end of the file instead of stopping, and
+// reopens the file if it's rotated by renaming or truncated. Next returns
+// (nil, nil) after the ctx is done.
+//
+// The data written to the old file before it's rotated is read first. The
+// lines are numbered from where the parser starts and from the beginning
+// of every new file, while the byte offsets are always in the file. The
+// last line of the old file is ended at the rotation even if it's not
+// terminated. A truncation is detected by the file getting smaller than
+// the read offset, so it's missed if the file grows back beyond the offset
+// between two polls.
+//
+// In multi-line mode an entry is returned after the next one is written or
+// the file is not written for an interval, since the parser can't tell
+// whether it's complete before that.
+func FollowFile(ctx context.Context, path string, opts FollowOptions) (*StreamParser, error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultFollowInterval
+	}
+	fr := &followReader{
+		ctx:      ctx,
+		path:     path,
+		interval: opts.Interval,
+	}
+	if err := fr.open(!opts.FromStart); err != nil {
+		return nil, err
+	}
+	sp := NewStreamParser(fr)
+	sp.Source = path
+	sp.positions = true
+	sp.closer = fr
+	sp.consumed = fr.offset
+	fr.rotated = func() {
+		// the lines are counted from the new file
+		sp.read = 0
+		sp.consumed = 0
+	}
+	return sp, nil
+}
+
+// errIdle is returned by followReader once the file is not written for an
+// interval, so that the entry waiting for its continuation is returned.
+var errIdle = errors.New("no new data")
+
+// followReader is an io.Reader which blocks at the end of the file until
+// new data is written.
+type followReader struct {
+	ctx      context.Context
+	path     string
+	interval time.Duration
+	rotated  func()
+
+	file   *os.File
+	info   os.FileInfo
+	offset int64
+	// partial is true if the last byte read is not '\n'
+	partial bool
+	// notify is true if rotated should be called at the next read
+	notify bool
+	// idle is true if errIdle is returned since the last data
+	idle  bool
+	timer *time.Timer
+}
+
+func (fr *followReader) open(seekEnd bool) error {
+	f, err := os.Open(fr.path)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	offset := int64(0)
+	if seekEnd {
+		if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if fr.file != nil {
+		fr.file.Close()
+	}
+	fr.file = f
+	fr.info = info
+	fr.offset = offset
+	return nil
+}
+
+func (fr *followReader) Read(p []byte) (int, error) {
+	if fr.notify {
+		fr.notify = false
+		if fr.rotated != nil {
+			fr.rotated()
+		}
+	}
+	waited := false
+	for {
+		n, err := fr.file.Read(p)
+		fr.offset += int64(n)
+		if n > 0 {
+			fr.partial = p[n-1] != '\n'
+			fr.idle = false
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		rotated, err := fr.checkRotation()
+		if err != nil {
+			return 0, err
+		}
+		if rotated && fr.partial && len(p) > 0 {
+			// end the unterminated last line of the old file, so it's not
+			// joined to the first line of the new one
+			fr.partial = false
+			fr.notify = true
+			p[0] = '\n'
+			return 1, nil
+		}
+		if rotated {
+			if fr.rotated != nil {
+				fr.rotated()
+			}
+			continue
+		}
+		if waited && !fr.idle {
+			fr.idle = true
+			return 0, errIdle
+		}
+		if fr.timer == nil {
+			fr.timer = time.NewTimer(fr.interval)
+		} else {
+			fr.timer.Reset(fr.interval)
+		}
+		select {
+		case <-fr.ctx.Done():
+			fr.timer.Stop()
+			return 0, io.EOF
+		case <-fr.timer.C:
+		}
+		waited = true
+	}
+}
+
+// checkRotation reopens the file if it's renamed or truncated, it should
+// only be called at the end of the file.
+func (fr *followReader) checkRotation() (bool, error) {
+	info, err := os.Stat(fr.path)
+	if os.IsNotExist(err) {
+		// renamed but the new one is not created yet
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(info, fr.info) {
+		if err := fr.open(false); err != nil {
+			if os.IsNotExist(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	if info.Size() < fr.offset {
+		if _, err := fr.file.Seek(0, io.SeekStart); err != nil {
+			return false, err
+		}
+		fr.offset = 0
+		return true, nil
+	}
+	return false, nil
+}
+
+func (fr *followReader) Close() error {
+	if fr.timer != nil {
+		fr.timer.Stop()
+	}
+	return fr.file.Close()
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func appendLog(t *testing.T, path string, messages ...string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	for _, msg := range messages {
+		_, err = fmt.Fprintf(f, "[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:1] [%s]\n", msg)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, f.Close())
+}
+
+func TestFollowFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tidb.log")
+	appendLog(t, path, "old")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := FollowFile(ctx, path, FollowOptions{Interval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	defer p.Close()
+
+	next := func() *LogEntry {
+		log, err := p.Next()
+		assert.Nil(t, err)
+		return log
+	}
+
+	// starts at the end of the file
+	appendLog(t, path, "1", "2")
+	log := next()
+	assert.Equal(t, "1", log.Message)
+	assert.Equal(t, &LogPosition{
+		Source: path,
+		Line:   1,
+		Offset: 58,
+		Raw:    "[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:1] [1]",
+	}, log.Position)
+	assert.Equal(t, "2", next().Message)
+
+	// rotated by renaming
+	assert.Nil(t, os.Rename(path, path+".1"))
+	appendLog(t, path+".1", "drained")
+	appendLog(t, path, "3", "4")
+	assert.Equal(t, "drained", next().Message)
+	log = next()
+	assert.Equal(t, "3", log.Message)
+	assert.Equal(t, 1, log.Position.Line)
+	assert.Equal(t, int64(0), log.Position.Offset)
+	assert.Equal(t, "4", next().Message)
+
+	// truncated
+	assert.Nil(t, os.Truncate(path, 0))
+	appendLog(t, path, "5")
+	assert.Equal(t, "5", next().Message)
+
+	cancel()
+	log, err = p.Next()
+	assert.Nil(t, log)
+	assert.Nil(t, err)
+}
+
+func TestFollowFileRotatedPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tidb.log")
+	appendLog(t, path, "1")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString("[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:1] [partial]")
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := FollowFile(ctx, path, FollowOptions{FromStart: true, Interval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	defer p.Close()
+	next := func() *LogEntry {
+		log, err := p.Next()
+		assert.Nil(t, err)
+		return log
+	}
+
+	assert.Equal(t, "1", next().Message)
+	assert.Nil(t, os.Rename(path, path+".1"))
+	appendLog(t, path, "2", "3")
+	log := next()
+	assert.Equal(t, "partial", log.Message)
+	assert.Equal(t, 2, log.Position.Line)
+	assert.Equal(t, int64(56), log.Position.Offset)
+	log = next()
+	assert.Equal(t, "2", log.Message)
+	assert.Equal(t, 1, log.Position.Line)
+	assert.Equal(t, int64(0), log.Position.Offset)
+	assert.Equal(t, "3", next().Message)
+}
+
+func TestFollowFileIdle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tidb.log")
+	appendLog(t, path, "old")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := FollowFile(ctx, path, FollowOptions{Interval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	p = p.WithMultiline(0)
+	defer p.Close()
+
+	// the last entry is returned once the file stops growing
+	appendLog(t, path, "fatal")
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = f.WriteString("panic: x\n")
+	assert.Nil(t, err)
+	assert.Nil(t, f.Close())
+	done := make(chan *LogEntry)
+	go func() {
+		log, err := p.Next()
+		assert.Nil(t, err)
+		done <- log
+	}()
+	select {
+	case log := <-done:
+		assert.Equal(t, "fatal", log.Message)
+		assert.Equal(t, []string{"panic: x"}, log.Continuation)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the last entry is held back")
+	}
+
+	appendLog(t, path, "1")
+	log, err := p.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "1", log.Message)
+
+	cancel()
+	log, err = p.Next()
+	assert.Nil(t, log)
+	assert.Nil(t, err)
+}
+
+func TestFollowFileFromStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tidb.log")
+	appendLog(t, path, "1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	p, err := FollowFile(ctx, path, FollowOptions{FromStart: true, Interval: 10 * time.Millisecond})
+	assert.Nil(t, err)
+	defer p.Close()
+	logs, _, err := p.ReadAll()
+	assert.Nil(t, err)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "1", logs[0].Message)
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strconv"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// Formatter renders a *LogEntry as a line of the unified log format, which
+// parses back to the same entry. The datetime is printed in TiDBTimeFormat
+// with as many fractional digits as needed to keep its precision. The lines
+// of Continuation are written as is, so they're parsed back in multi-line
+// mode unless one of them is a valid log header itself, which starts a new
+// entry.
+type Formatter struct {
+	// Location is the timezone of the datetime, nil keeps the timezone
+	// of every log, ie. the one it's parsed in.
+	Location *time.Location
+}
+
+// Format renders the log as a line of the unified log format, the lines
+// of Continuation are appended after it separated by '\n', see Formatter.
+// The Position is not rendered.
+func Format(e *LogEntry) string {
+	return (&Formatter{}).Format(e)
+}
+
+// Format renders the log as a line of the unified log format, see Format.
+func (f *Formatter) Format(e *LogEntry) string {
+	return string(f.AppendFormat(nil, e))
+}
+
+// AppendFormat appends the rendered log to buf and returns the extended
+// buffer.
+func (f *Formatter) AppendFormat(buf []byte, e *LogEntry) []byte {
+	datetime := e.Header.DateTime
+	if f.Location != nil {
+		datetime = datetime.In(f.Location)
+	}
+	buf = append(buf, '[')
+	buf = appendDateTime(buf, datetime)
+	buf = append(buf, "] ["...)
+	buf = append(buf, e.Header.Level...)
+	buf = append(buf, "] ["...)
+	if e.Header.File == "<unknown>" && e.Header.Line == 0 {
+		buf = append(buf, e.Header.File...)
+	} else {
+		buf = appendString(buf, e.Header.File+":"+strconv.FormatUint(uint64(e.Header.Line), 10))
+	}
+	buf = append(buf, "] ["...)
+	buf = appendString(buf, e.Message)
+	buf = append(buf, ']')
+	for _, field := range e.Fields {
+		buf = append(buf, " ["...)
+		buf = appendString(buf, field.Name)
+		buf = append(buf, '=')
+		buf = appendString(buf, field.Value)
+		buf = append(buf, ']')
+	}
+	for _, line := range e.Continuation {
+		buf = append(buf, '\n')
+		buf = append(buf, line...)
+	}
+	return buf
+}
+
+// appendDateTime appends t in TiDBTimeFormat, the milliseconds are extended
+// to microseconds or nanoseconds if they're not precise enough.
+func appendDateTime(buf []byte, t time.Time) []byte {
+	layout := TiDBTimeFormat
+	switch ns := t.Nanosecond(); {
+	case ns%int(time.Microsecond) != 0:
+		layout = "2006/01/02 15:04:05.000000000 -07:00"
+	case ns%int(time.Millisecond) != 0:
+		layout = "2006/01/02 15:04:05.000000 -07:00"
+	}
+	return t.AppendFormat(buf, layout)
+}
+
+// appendString appends s as a bare string if it's safe, otherwise quoted.
+func appendString(buf []byte, s string) []byte {
+	if !needsQuote(s) {
+		return append(buf, s...)
+	}
+	buf = append(buf, '"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf = append(buf, '\\', 'x', hexDigits[s[i]>>4], hexDigits[s[i]&0xf])
+		case r == '"' || r == '\\':
+			buf = append(buf, '\\', byte(r))
+		case r == '\n':
+			buf = append(buf, '\\', 'n')
+		case r == '\r':
+			buf = append(buf, '\\', 'r')
+		case r == '\t':
+			buf = append(buf, '\\', 't')
+		case r < 0x20 || r == 0x7f:
+			buf = append(buf, '\\', 'u', '0', '0', hexDigits[r>>4], hexDigits[r&0xf])
+		default:
+			buf = append(buf, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(buf, '"')
+}
+
+// needsQuote tells if s can't be written as a bare string. Like the
+// components do, the strings with spaces are quoted though bare strings
+// may contain them.
+func needsQuote(s string) bool {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return true
+		}
+		switch r {
+		case '"', '\\', '[', ']', '=':
+			return true
+		}
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		line      string
+		formatted string
+	}{
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [msg] [k=v]`, `[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [msg] [k=v]`},
+		{`[2021/12/13 20:41:00.755 +08:00] [WARN] [a.go:1] [unquoted message with spaces]`, `[2021/12/13 20:41:00.755 +08:00] [WARN] [a.go:1] ["unquoted message with spaces"]`},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [<unknown>] [""] [=] [k=]`, `[2021/12/13 20:41:00.755 +08:00] [INFO] [<unknown>] [] [=] [k=]`},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["]"] ["="="]"]`, `[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["]"] ["="="]"]`},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [stack="a\n\tb\\ \"c\" \x01 \xff"]`, `[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [stack="a\n\tb\\ \"c\" \u0001 \xff"]`},
+		{`[2021/12/13 20:41:00.755123 +08:00] [INFO] [a.go:1] [m] [中文=值]`, `[2021/12/13 20:41:00.755123 +08:00] [INFO] [a.go:1] [m] [中文=值]`},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a:b:1] [m]`, `[2021/12/13 20:41:00.755 +08:00] [INFO] [a:b:1] [m]`},
+		{`2021/12/13 20:41:00.755 tikv.rs:1: [ERROR] legacy`, `[2021/12/13 20:41:00.755 +08:00] [ERROR] [tikv.rs:1] [legacy]`},
+	}
+	local := time.Local
+	time.Local = time.FixedZone("", 8*3600)
+	defer func() { time.Local = local }()
+
+	for _, test := range tests {
+		e, err := parseEntry(test.line)
+		assert.Nil(t, err, test.line)
+		formatted := Format(e)
+		assert.Equal(t, test.formatted, formatted, test.line)
+		e2, err := parseEntry(formatted)
+		assert.Nil(t, err, test.line)
+		assert.Equal(t, e, e2, test.line)
+	}
+
+	e, _ := parseEntry(tests[len(tests)-2].line)
+	assert.Equal(t, "a:b", e.Header.File)
+	assert.Equal(t, uint(1), e.Header.Line)
+
+	e, _ = parseEntry(tests[0].line)
+	f := Formatter{Location: time.UTC}
+	assert.Equal(t, `[2021/12/13 12:41:00.755 +00:00] [INFO] [a.go:1] [msg] [k=v]`, f.Format(e))
+}
+
+func TestFormatContinuation(t *testing.T) {
+	e := &LogEntry{
+		Header: LogHeader{
+			DateTime: time.Date(2021, 12, 13, 20, 41, 0, 755000000, time.UTC),
+			Level:    LogLevelFatal,
+			File:     "a.go",
+			Line:     1,
+		},
+		Message:      "panic",
+		Fields:       []LogField{},
+		Continuation: []string{"[1] x", `{"a":1}`, "2019/03/11 14:33:58.123 x", "\tmain.go:1"},
+	}
+	logs, _, err := NewStreamParser(strings.NewReader(Format(e))).WithLocation(time.UTC).WithMultiline(0).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*LogEntry{e}, logs)
+
+	// a continuation line which is a log header starts a new entry
+	e.Continuation = nil
+	e.Continuation = []string{Format(e)}
+	logs, _, err = NewStreamParser(strings.NewReader(Format(e))).WithLocation(time.UTC).WithMultiline(0).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(logs))
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	alphabet := []string{"a", "Z", "0", ":", "C:", ".go", " ", "\t", "\n", "\r", "[", "]", "=", `"`, `\`, "'", "/", "*", "中", "\x00", "\x7f", "\xff", "\xe4\xb8", " ", "<unknown>"}
+	r := rand.New(rand.NewSource(1))
+	randString := func() string {
+		b := strings.Builder{}
+		for n := r.Intn(8); n > 0; n-- {
+			b.WriteString(alphabet[r.Intn(len(alphabet))])
+		}
+		return b.String()
+	}
+
+	for i := 0; i < 2000; i++ {
+		e := &LogEntry{
+			Header: LogHeader{
+				DateTime: time.Unix(1639399260, r.Int63n(int64(time.Second))).In(time.FixedZone("", 8*3600)),
+				Level:    LogLevelInfo,
+				File:     randString() + "a.go",
+				Line:     uint(r.Intn(1000)),
+			},
+			Message: randString(),
+			Fields:  []LogField{},
+		}
+		for n := r.Intn(4); n > 0; n-- {
+			e.Fields = append(e.Fields, LogField{Name: randString(), Value: randString()})
+		}
+		line := Format(e)
+		parsed, err := parseEntry(line)
+		if !assert.Nil(t, err, line) {
+			continue
+		}
+		assert.True(t, e.Header.DateTime.Equal(parsed.Header.DateTime), line)
+		parsed.Header.DateTime = e.Header.DateTime
+		assert.Equal(t, e, parsed, line)
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// LogFormat is an enumeration type for the log format, which is
+// configured by `log.format` of the components.
+type LogFormat string
+
+const (
+	// LogFormatAuto detects the format of every line.
+	LogFormatAuto LogFormat = "auto"
+	LogFormatText LogFormat = "text"
+	LogFormatJSON LogFormat = "json"
+)
+
+// The keys of the header in JSON logs, the other keys are fields.
+var (
+	jsonTimeKeys    = []string{"time", "ts"}
+	jsonLevelKeys   = []string{"level"}
+	jsonCallerKeys  = []string{"caller"}
+	jsonMessageKeys = []string{"message", "msg"}
+)
+
+// isJSONLine checks if the line looks like a JSON log.
+func isJSONLine(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	return len(line) > 0 && line[0] == '{'
+}
+
+// parseJSONEntry parses one JSON log line like
+//
+//	{"level":"INFO","time":"2021/12/13 20:41:00.755 +08:00","caller":"store.go:68","message":"new store","path":"unistore:///tmp/tidb"}
+//
+// into the same LogEntry as its text counterpart. The fields are kept in the
+// order of the line, string values are unquoted and the other values (numbers,
+// booleans, objects, ...) are kept as their JSON text. A truncated line is
+// parsed as far as it goes if its time and level are there.
+func parseJSONEntry(line string, times *timeParser, truncated bool) (*LogEntry, *ParseError) {
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	log := &LogEntry{
+		Header:    LogHeader{File: "<unknown>"},
+		Fields:    []LogField{},
+		Truncated: truncated,
+	}
+	hasTime, hasLevel := false, false
+	fail := func(err error) (*LogEntry, *ParseError) {
+		if truncated && hasTime && hasLevel && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			// the fields parsed so far are kept for a truncated line
+			return log, nil
+		}
+		offset := int(dec.InputOffset())
+		if serr, ok := err.(*json.SyntaxError); ok && serr.Offset > 0 {
+			// the error occurs after reading the offending byte
+			offset = int(serr.Offset) - 1
+		}
+		if offset > len(line) {
+			offset = len(line)
+		}
+		return nil, &ParseError{
+			Column: offset + 1,
+			Token:  tokenAt(line, offset),
+			Err:    err,
+		}
+	}
+
+	if tok, err := dec.Token(); err != nil {
+		return fail(err)
+	} else if tok != json.Delim('{') {
+		return fail(&UnexpectedTokenError{ExpectedToken: "{", GotToken: fmt.Sprint(tok)})
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fail(err)
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fail(&UnexpectedTokenError{ExpectedToken: "<string>", GotToken: fmt.Sprint(tok)})
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fail(err)
+		}
+		value, err := jsonValue(raw)
+		if err != nil {
+			return fail(err)
+		}
+
+		switch {
+		case !hasTime && contains(jsonTimeKeys, key):
+			if log.Header.DateTime, err = parseJSONTime(raw, value, times); err != nil {
+				return fail(err)
+			}
+			hasTime = true
+		case !hasLevel && contains(jsonLevelKeys, key):
+			if log.Header.Level, err = parseLogLevel(strings.ToUpper(value)); err != nil {
+				return fail(err)
+			}
+			hasLevel = true
+		case contains(jsonCallerKeys, key):
+			if log.Header.File, log.Header.Line, err = parseFileLine(value); err != nil {
+				return fail(err)
+			}
+		case contains(jsonMessageKeys, key):
+			log.Message = value
+		default:
+			log.Fields = append(log.Fields, LogField{Name: key, Value: value})
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fail(err)
+	}
+	if !hasTime {
+		return fail(&UnexpectedEOLError{ExpectedToken: "time"})
+	}
+	if !hasLevel {
+		return fail(&UnexpectedEOLError{ExpectedToken: "level"})
+	}
+	return log, nil
+}
+
+// jsonValue converts a JSON value to the field value.
+func jsonValue(raw json.RawMessage) (string, error) {
+	if len(raw) > 0 && raw[0] == '"' {
+		s := ""
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	}
+	buf := bytes.Buffer{}
+	if err := json.Compact(&buf, raw); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// parseJSONTime parses the time in the text format or the unix timestamp
+// in seconds.
+func parseJSONTime(raw json.RawMessage, value string, times *timeParser) (time.Time, error) {
+	if len(raw) > 0 && raw[0] == '"' {
+		return times.parse(value)
+	}
+	var ts float64
+	if err := json.Unmarshal(raw, &ts); err != nil {
+		return time.Time{}, errors.New("invalid time " + value)
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9)).Round(time.Microsecond), nil
+}
+
+// tokenAt returns the token at the offset of the line for error reporting.
+func tokenAt(line string, offset int) string {
+	end := offset
+	for end < len(line) && !strings.ContainsRune(` ,:{}[]`, rune(line[end])) {
+		end++
+	}
+	if end == offset && end < len(line) {
+		end++
+	}
+	return line[offset:end]
+}
+
+func contains(xs []string, x string) bool {
+	for _, s := range xs {
+		if s == x {
+			return true
+		}
+	}
+	return false
+}
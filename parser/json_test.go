@@ -0,0 +1,82 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJSON(t *testing.T) {
+	tests := map[string]string{
+		`{"level":"INFO","time":"2021/12/13 20:41:00.755 +08:00","caller":"store.go:68","message":"new store","path":"unistore:///tmp/tidb"}`: `[2021/12/13 20:41:00.755 +08:00] [INFO] [store.go:68] ["new store"] [path=unistore:///tmp/tidb]`,
+		// field order, non-string values and escapes
+		`{"level":"warn","time":"2021/12/13 20:41:00.755 +08:00","caller":"printer.go:33","message":"Welcome to TiDB.","Release Version":"v5.2.0","Race Enabled":false,"port":4000,"ratio":0.8,"labels":{ "zone" : "z1" },"stores":[1, 2],"x":null,"sql":"select \"a\"\n"}`: `[2021/12/13 20:41:00.755 +08:00] [WARN] [printer.go:33] ["Welcome to TiDB."] ["Release Version"=v5.2.0] ["Race Enabled"=false] [port=4000] [ratio=0.8] [labels="{\"zone\":\"z1\"}"] [stores="[1,2]"] [x=null] [sql="select \"a\"\n"]`,
+		// no caller and the msg key
+		`{"time":"2021/12/13 20:41:00.755 +08:00","level":"ERROR","msg":"m","x":"1","x":"2"}`: `[2021/12/13 20:41:00.755 +08:00] [ERROR] [<unknown>] [m] [x=1] [x=2]`,
+	}
+	for js, txt := range tests {
+		expected, err := parseEntry(txt)
+		assert.Nil(t, err, txt)
+		l, err := parseJSONEntry(js, defaultTimeParser(), false)
+		assert.Nil(t, err, js)
+		assert.Equal(t, expected, l)
+	}
+
+	// unix timestamp
+	l, err := parseJSONEntry(`{"level":"INFO","ts":1639399260.755,"message":"m"}`, defaultTimeParser(), false)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Unix(1639399260, 755000000), l.Header.DateTime)
+
+	for _, js := range []string{
+		`{"level":"INFO","message":"no time"}`,
+		`{"time":"2021/12/13 20:41:00.755 +08:00","message":"no level"}`,
+		`{"level":"NOTICE","time":"2021/12/13 20:41:00.755 +08:00","message":"m"}`,
+		`{"level":"INFO","time":"yesterday","message":"m"}`,
+		`{"level":"INFO","time":"2021/12/13 20:41:00.755 +08:00","message":"m"`,
+		`{"level":"INFO","time":"2021/12/13 20:41:00.755 +08:00","message":m}`,
+		`["level","INFO"]`,
+	} {
+		_, err := parseJSONEntry(js, defaultTimeParser(), false)
+		assert.NotNil(t, err, js)
+	}
+
+	_, err = parseJSONEntry(`{"level":"INFO","time":"2021/12/13 20:41:00.755 +08:00","message":m}`, defaultTimeParser(), false)
+	assert.Equal(t, 67, err.Column)
+	assert.Equal(t, "m", err.Token)
+}
+
+func TestStreamFormat(t *testing.T) {
+	logtxt := `[2021/12/13 20:41:00.755 +08:00] [INFO] [store.go:68] ["new store"] [path=unistore:///tmp/tidb]
+{"level":"INFO","time":"2021/12/13 20:41:00.755 +08:00","caller":"store.go:68","message":"new store","path":"unistore:///tmp/tidb"}
+`
+	logs, err := ParseFromString(logtxt)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(logs))
+	assert.Equal(t, logs[0], logs[1])
+
+	_, errs, err := NewStreamParser(strings.NewReader(logtxt)).WithFormat(LogFormatText).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, 2, errs[0].Line)
+
+	_, errs, err = NewStreamParser(strings.NewReader(logtxt)).WithFormat(LogFormatJSON).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, 1, errs[0].Line)
+}
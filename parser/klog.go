@@ -0,0 +1,187 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TiDB Operator logs with klog, whose header is "Lmmdd hh:mm:ss.uuuuuu
+// threadid file:line]" where L is one of IWEF:
+//
+//	I1213 20:41:00.755123       1 tidb_cluster_control.go:123] TidbCluster: [default/basic] updated successfully
+//	I1213 20:41:00.755123       1 tidb_cluster_control.go:123] "sync TidbCluster" namespace="default" name="basic"
+//
+// The structured logs of klog v2 have a quoted message followed by the
+// key="value" fields, the message of the others is the whole text after the
+// header. The header has no year and timezone, the datetime is taken in the
+// location of the time parser and the latest year not in the future of the
+// reference time, see WithReferenceTime.
+
+const klogTimeFormat = "2006 0102 15:04:05.999999"
+
+var klogLevels = map[byte]LogLevel{
+	'I': LogLevelInfo,
+	'W': LogLevelWarn,
+	'E': LogLevelError,
+	'F': LogLevelFatal,
+}
+
+// isKlogLine checks if the line starts with a klog header "Lmmdd hh:".
+func isKlogLine(line string) bool {
+	if len(line) < 9 || klogLevels[line[0]] == "" || line[5] != ' ' || line[8] != ':' {
+		return false
+	}
+	for _, i := range []int{1, 2, 3, 4, 6, 7} {
+		if line[i] < '0' || line[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseKlogEntry(line string, times *timeParser) (*LogEntry, *ParseError) {
+	fail := func(tok string, at int, err error) (*LogEntry, *ParseError) {
+		return nil, &ParseError{Column: at + 1, Token: tok, Err: err}
+	}
+	end := strings.Index(line, "] ")
+	if end < 0 {
+		if !strings.HasSuffix(line, "]") {
+			return fail(line, 0, &UnexpectedTokenError{ExpectedToken: "]", GotToken: "EOL"})
+		}
+		end = len(line) - 1
+	}
+	header := strings.Fields(line[1:end])
+	if len(header) != 4 {
+		return fail(line[:end+1], 0, &UnexpectedTokenError{
+			ExpectedToken: "Lmmdd hh:mm:ss.uuuuuu threadid file:line]",
+			GotToken:      line[:end+1],
+		})
+	}
+	datetime, err := parseKlogTime(header[0]+" "+header[1], times)
+	if err != nil {
+		return fail(header[0]+" "+header[1], 1, err)
+	}
+	file, fileLine, err := parseFileLine(header[3])
+	if err != nil {
+		return fail(header[3], strings.LastIndex(line[:end], header[3]), err)
+	}
+
+	log := &LogEntry{
+		Header: LogHeader{
+			DateTime: datetime,
+			Level:    klogLevels[line[0]],
+			File:     file,
+			Line:     fileLine,
+		},
+		Fields: []LogField{},
+	}
+	text := ""
+	if end+2 <= len(line) {
+		text = line[end+2:]
+	}
+	if !strings.HasPrefix(text, `"`) {
+		log.Message = strings.TrimSpace(text)
+		return log, nil
+	}
+	msg, rest, ok := klogQuoted(text)
+	if !ok {
+		log.Message = strings.TrimSpace(text)
+		return log, nil
+	}
+	log.Message = msg
+	fields, ok := klogFields(rest)
+	if !ok {
+		// not a structured log though quoted
+		log.Message = strings.TrimSpace(text)
+		return log, nil
+	}
+	log.Fields = fields
+	return log, nil
+}
+
+// parseKlogTime parses the datetime without year, the year is the latest
+// one which makes the datetime valid, eg. Feb 29 in a leap year, and no
+// later than a day after the reference time.
+func parseKlogTime(s string, times *timeParser) (time.Time, error) {
+	now := times.now()
+	var firstErr error
+	// there is a leap year in any 8 years, eg. 1897 to 1904
+	for year := now.Year() + 1; year > now.Year()-8; year-- {
+		t, err := time.ParseInLocation(klogTimeFormat, strconv.Itoa(year)+" "+s, times.location)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !t.After(now.Add(24 * time.Hour)) {
+			return t, nil
+		}
+	}
+	return time.Time{}, firstErr
+}
+
+// klogFields parses the key=value pairs separated by spaces, the values
+// are either quoted or bare.
+func klogFields(s string) ([]LogField, bool) {
+	fields := []LogField{}
+	for {
+		s = strings.TrimLeft(s, " ")
+		if s == "" {
+			return fields, true
+		}
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], ` "`) {
+			return nil, false
+		}
+		name := s[:eq]
+		s = s[eq+1:]
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var ok bool
+			if value, s, ok = klogQuoted(s); !ok {
+				return nil, false
+			}
+		} else {
+			end := strings.IndexByte(s, ' ')
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		fields = append(fields, LogField{Name: name, Value: value})
+	}
+}
+
+// klogQuoted unquotes the Go quoted string at the beginning of s and returns
+// the rest after it.
+func klogQuoted(s string) (string, string, bool) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", false
+			}
+			return v, s[i+1:], true
+		}
+	}
+	return "", "", false
+}
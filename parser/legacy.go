@@ -0,0 +1,120 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+)
+
+// The components before the unified log format (v2.x and earlier) write
+// headers without brackets:
+//
+//	2019/03/11 14:33:58.123 server.go:166: [info] [con:1] new connection 127.0.0.1:53498	(TiDB, PD)
+//	2019/03/11 14:33:58.123 INFO mod.rs:26: Welcome to TiKV.				(TiKV)
+//
+// These logs have no fields, the whole text after the header is the message.
+
+// isLegacyLine checks if the line starts with an unbracketed "yyyy/MM/dd HH"
+// datetime.
+func isLegacyLine(line string) bool {
+	line = strings.TrimLeft(line, " \t")
+	if len(line) < 13 {
+		return false
+	}
+	for i := 0; i < 13; i++ {
+		switch i {
+		case 4, 7:
+			if line[i] != '/' {
+				return false
+			}
+		case 10:
+			if line[i] != ' ' {
+				return false
+			}
+		default:
+			if line[i] < '0' || line[i] > '9' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseLegacyEntry(line string, times *timeParser) (*LogEntry, *ParseError) {
+	pos := len(line) - len(strings.TrimLeft(line, " \t"))
+	// next returns the next space separated word
+	next := func() (string, int) {
+		for pos < len(line) && line[pos] == ' ' {
+			pos++
+		}
+		start := pos
+		for pos < len(line) && line[pos] != ' ' {
+			pos++
+		}
+		return line[start:pos], start
+	}
+	fail := func(tok string, at int, err error) (*LogEntry, *ParseError) {
+		return nil, &ParseError{Column: at + 1, Token: tok, Err: err}
+	}
+
+	date, at := next()
+	clock, _ := next()
+	datetime, err := times.parse(date + " " + clock)
+	if err != nil {
+		return fail(line[at:pos], at, err)
+	}
+
+	word, at := next()
+	level, err := parseLogLevel(word)
+	levelFirst := err == nil
+	if levelFirst {
+		// TiKV: LEVEL file:line: message
+		word, at = next()
+	}
+	if !strings.HasSuffix(word, ":") {
+		return fail(word, at, &UnexpectedTokenError{
+			ExpectedToken: "file:line:",
+			GotToken:      word,
+		})
+	}
+	file, fileLine, err := parseFileLine(strings.TrimSuffix(word, ":"))
+	if err != nil {
+		return fail(word, at, err)
+	}
+	if !levelFirst {
+		// TiDB and PD: file:line: [level] message
+		word, at = next()
+		if len(word) < 2 || word[0] != '[' || word[len(word)-1] != ']' {
+			return fail(word, at, &UnexpectedTokenError{
+				ExpectedToken: "[level]",
+				GotToken:      word,
+			})
+		}
+		if level, err = parseLogLevel(word[1 : len(word)-1]); err != nil {
+			return fail(word, at, err)
+		}
+	}
+
+	return &LogEntry{
+		Header: LogHeader{
+			DateTime: datetime,
+			Level:    level,
+			File:     file,
+			Line:     fileLine,
+		},
+		Message: strings.TrimSpace(line[pos:]),
+		Fields:  []LogField{},
+	}, nil
+}
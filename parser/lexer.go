@@ -0,0 +1,298 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// The lexer splits one line of the unified log format into tokens, see
+// https://github.com/tikv/rfcs/blob/master/text/0018-unified-log-format.md
+//
+//	Token		= '[' | ']' | '=' | QuotedString | BareString
+//	QuotedString	= '"', {<byte> | Escape}, '"'
+//	Escape		= '\', ( '"' | '\' | '/' | 'a' | 'b' | 'f' | 'n' | 'r' | 't' | 'v' |
+//			  'x' hex hex | 'u' hex hex hex hex | 'u{' hex {hex} '}' )
+//	BareString	= <byte except whitespace and '[', ']', '=', '"'>, {<byte except '[', ']', '='> | '\' ( '[' | ']' | '=' | '\' | ' ' )}
+//
+// Tokens are separated by optional whitespace. Bare strings may contain
+// spaces but not the trailing ones, and the brackets, '=', '\' and space
+// can be escaped in them by a backslash, eg. '\]', the other backslashes are
+// literal like in C:\dir. Unknown escapes in quoted strings are kept as is.
+// Bytes are never validated, so invalid UTF-8 passes through unchanged.
+
+var errUnterminatedString = errors.New("unterminated quoted string")
+
+// lexer is a byte-level tokenizer of a log line. A lexer can be reused
+// for many lines to save allocations.
+type lexer struct {
+	line   string
+	pos    int
+	buf    strings.Builder
+	tokens []token
+	// partial accepts an unterminated quoted string at the end of a
+	// truncated line
+	partial bool
+}
+
+// lex splits the line into tokens.
+func lex(line string) ([]token, *ParseError) {
+	l := lexer{}
+	return l.lex(line)
+}
+
+// lex splits the line into tokens, the returned slice is only valid until
+// the next call.
+func (l *lexer) lex(line string) ([]token, *ParseError) {
+	l.line = line
+	l.pos = 0
+	l.tokens = l.tokens[:0]
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.line) {
+			return l.tokens, nil
+		}
+		tok, err := l.next()
+		if err != nil {
+			return nil, &ParseError{
+				Column: tok.pos + 1,
+				Token:  l.line[tok.pos:l.pos],
+				Err:    err,
+			}
+		}
+		l.tokens = append(l.tokens, tok)
+	}
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.line) && isSpace(l.line[l.pos]) {
+		l.pos++
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	start := l.pos
+	switch l.line[l.pos] {
+	case '[':
+		l.pos++
+		return token{typ: TokenTypeLBracket, text: "[", raw: "[", pos: start}, nil
+	case ']':
+		l.pos++
+		return token{typ: TokenTypeRBracket, text: "]", raw: "]", pos: start}, nil
+	case '=':
+		l.pos++
+		return token{typ: TokenTypeEQ, text: "=", raw: "=", pos: start}, nil
+	case '"':
+		text, err := l.quoted()
+		tok := token{typ: TokenTypeString, text: text, raw: l.line[start:l.pos], pos: start, quoted: true}
+		return tok, err
+	default:
+		text := l.bare()
+		return token{typ: TokenTypeString, text: text, raw: l.line[start:l.pos], pos: start}, nil
+	}
+}
+
+// bare scans a bare string, the trailing spaces are not part of it.
+func (l *lexer) bare() string {
+	start, end := l.pos, l.pos
+	// fast path for strings without escapes
+	for l.pos < len(l.line) {
+		c := l.line[l.pos]
+		if c == '[' || c == ']' || c == '=' {
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.line) && isBareEscape(l.line[l.pos+1]) {
+			l.pos = start
+			return l.bareEscaped()
+		}
+		l.pos++
+		if !isSpace(c) {
+			end = l.pos
+		}
+	}
+	// rewind the trailing spaces so that they are skipped as separators
+	l.pos = end
+	return l.line[start:end]
+}
+
+func (l *lexer) bareEscaped() string {
+	l.buf.Reset()
+	end := 0
+	for l.pos < len(l.line) {
+		c := l.line[l.pos]
+		if c == '[' || c == ']' || c == '=' {
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.line) && isBareEscape(l.line[l.pos+1]) {
+			l.buf.WriteByte(l.line[l.pos+1])
+			l.pos += 2
+			end = l.buf.Len()
+			continue
+		}
+		l.buf.WriteByte(c)
+		l.pos++
+		if !isSpace(c) {
+			end = l.buf.Len()
+		}
+	}
+	l.pos -= l.buf.Len() - end
+	return l.buf.String()[:end]
+}
+
+// isBareEscape tells if the char is escaped by '\\' in a bare string, the
+// other backslashes are literal, eg. in C:\dir.
+func isBareEscape(c byte) bool {
+	switch c {
+	case '[', ']', '=', '\\', ' ':
+		return true
+	}
+	return false
+}
+
+// quoted scans a quoted string and decodes the escapes in it.
+func (l *lexer) quoted() (string, error) {
+	l.pos++ // opening quote
+	start := l.pos
+	// fast path for strings without escapes
+	for l.pos < len(l.line) {
+		c := l.line[l.pos]
+		if c == '"' {
+			l.pos++
+			return l.line[start : l.pos-1], nil
+		}
+		if c == '\\' {
+			break
+		}
+		l.pos++
+	}
+	l.buf.Reset()
+	l.buf.WriteString(l.line[start:l.pos])
+	for l.pos < len(l.line) {
+		c := l.line[l.pos]
+		switch c {
+		case '"':
+			l.pos++
+			return l.buf.String(), nil
+		case '\\':
+			l.escape()
+		default:
+			l.buf.WriteByte(c)
+			l.pos++
+		}
+	}
+	if l.partial {
+		return l.buf.String(), nil
+	}
+	return "", errUnterminatedString
+}
+
+// escape decodes the escape sequence at l.pos into l.buf.
+func (l *lexer) escape() {
+	if l.pos+1 >= len(l.line) {
+		// a lone backslash at the end of line, the string is unterminated anyway
+		l.buf.WriteByte('\\')
+		l.pos++
+		return
+	}
+	c := l.line[l.pos+1]
+	l.pos += 2
+	switch c {
+	case '"', '\\', '/':
+		l.buf.WriteByte(c)
+	case 'a':
+		l.buf.WriteByte('\a')
+	case 'b':
+		l.buf.WriteByte('\b')
+	case 'f':
+		l.buf.WriteByte('\f')
+	case 'n':
+		l.buf.WriteByte('\n')
+	case 'r':
+		l.buf.WriteByte('\r')
+	case 't':
+		l.buf.WriteByte('\t')
+	case 'v':
+		l.buf.WriteByte('\v')
+	case 'x':
+		if v, ok := l.hex(2); ok {
+			l.buf.WriteByte(byte(v))
+			return
+		}
+		l.buf.WriteString(`\x`)
+	case 'u':
+		if l.pos < len(l.line) && l.line[l.pos] == '{' {
+			// rust style \u{1F600}
+			if end := strings.IndexByte(l.line[l.pos:], '}'); end > 1 && end <= 7 {
+				if v, err := strconv.ParseUint(l.line[l.pos+1:l.pos+end], 16, 32); err == nil {
+					l.writeRune(rune(v))
+					l.pos += end + 1
+					return
+				}
+			}
+			l.buf.WriteString(`\u`)
+			return
+		}
+		v, ok := l.hex(4)
+		if !ok {
+			l.buf.WriteString(`\u`)
+			return
+		}
+		r := rune(v)
+		if r >= 0xd800 && r < 0xdc00 {
+			// surrogate pair
+			if l.pos+1 < len(l.line) && l.line[l.pos] == '\\' && l.line[l.pos+1] == 'u' {
+				pos := l.pos
+				l.pos += 2
+				if v2, ok := l.hex(4); ok && v2 >= 0xdc00 && v2 < 0xe000 {
+					r = (r-0xd800)<<10 + (rune(v2) - 0xdc00) + 0x10000
+				} else {
+					l.pos = pos
+				}
+			}
+		}
+		l.writeRune(r)
+	default:
+		// unknown escapes are kept as is
+		l.buf.WriteByte('\\')
+		l.buf.WriteByte(c)
+	}
+}
+
+// hex reads n hex digits at l.pos.
+func (l *lexer) hex(n int) (uint64, bool) {
+	if l.pos+n > len(l.line) {
+		return 0, false
+	}
+	v, err := strconv.ParseUint(l.line[l.pos:l.pos+n], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	l.pos += n
+	return v, true
+}
+
+func (l *lexer) writeRune(r rune) {
+	if !utf8.ValidRune(r) {
+		r = utf8.RuneError
+	}
+	l.buf.WriteRune(r)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+}
@@ -0,0 +1,151 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		line   string
+		tokens []string // decoded texts
+		err    bool
+	}{
+		// separators
+		{``, []string{}, false},
+		{" \t ", []string{}, false},
+		{`[]=`, []string{"[", "]", "="}, false},
+		{` [ a ] `, []string{"[", "a", "]"}, false},
+		{"[a]\t[b]\r", []string{"[", "a", "]", "[", "b", "]"}, false},
+		// bare strings
+		{`[2021/12/13 20:41:00.755 +08:00]`, []string{"[", "2021/12/13 20:41:00.755 +08:00", "]"}, false},
+		{`[<unknown>]`, []string{"[", "<unknown>", "]"}, false},
+		{`[path=unistore:///tmp/tidb]`, []string{"[", "path", "=", "unistore:///tmp/tidb", "]"}, false},
+		{`[Release Version=v5.2.0]`, []string{"[", "Release Version", "=", "v5.2.0", "]"}, false},
+		{`[a  =  b  ]`, []string{"[", "a", "=", "b", "]"}, false},
+		{`[x=/* not a comment */]`, []string{"[", "x", "=", "/* not a comment */", "]"}, false},
+		{`[x=// not a comment]`, []string{"[", "x", "=", "// not a comment", "]"}, false},
+		{`[x=it's]`, []string{"[", "x", "=", "it's", "]"}, false},
+		{`[x='a']`, []string{"[", "x", "=", "'a'", "]"}, false},
+		{`[x=1.5e3]`, []string{"[", "x", "=", "1.5e3", "]"}, false},
+		{`[x=a"b"c]`, []string{"[", "x", "=", `a"b"c`, "]"}, false},
+		{`[x=a\]b\=c\[d]`, []string{"[", "x", "=", "a]b=c[d", "]"}, false},
+		{`[x=a\ ]`, []string{"[", "x", "=", "a ", "]"}, false},
+		{`[x=C:\dir]`, []string{"[", "x", "=", `C:\dir`, "]"}, false},
+		{`[x=C:\\dir\n]`, []string{"[", "x", "=", `C:\dir\n`, "]"}, false},
+		{`[x=a\ \=b\x]`, []string{"[", "x", "=", `a =b\x`, "]"}, false},
+		{`[x=中文]`, []string{"[", "x", "=", "中文", "]"}, false},
+		{"[x=\xff\xfe]", []string{"[", "x", "=", "\xff\xfe", "]"}, false},
+		// quoted strings
+		{`[""]`, []string{"[", "", "]"}, false},
+		{`["a b"]`, []string{"[", "a b", "]"}, false},
+		{`["[=]"]`, []string{"[", "[=]", "]"}, false},
+		{`["Release Version"=v5.2.0]`, []string{"[", "Release Version", "=", "v5.2.0", "]"}, false},
+		{`["a \"quoted\" string"]`, []string{"[", `a "quoted" string`, "]"}, false},
+		{`["back\\slash"]`, []string{"[", `back\slash`, "]"}, false},
+		{`["a\/b"]`, []string{"[", "a/b", "]"}, false},
+		{`["\a\b\f\n\r\t\v"]`, []string{"[", "\a\b\f\n\r\t\v", "]"}, false},
+		{`["\x41\x4a"]`, []string{"[", "AJ", "]"}, false},
+		{`["\xff"]`, []string{"[", "\xff", "]"}, false},
+		{`["\x4"]`, []string{"[", `\x4`, "]"}, false},
+		{`["\u00e9"]`, []string{"[", "é", "]"}, false},
+		{`["\u001b[0m"]`, []string{"[", "\x1b[0m", "]"}, false},
+		{`["\ud83d\ude00"]`, []string{"[", "😀", "]"}, false},
+		{`["\ud83d"]`, []string{"[", "\ufffd", "]"}, false},
+		{`["\ud83dx"]`, []string{"[", "\ufffdx", "]"}, false},
+		{`["\u{1F600}"]`, []string{"[", "😀", "]"}, false},
+		{`["\u{110000}"]`, []string{"[", "\ufffd", "]"}, false},
+		{`["\u{}"]`, []string{"[", `\u{}`, "]"}, false},
+		{`["\uzzzz"]`, []string{"[", `\uzzzz`, "]"}, false},
+		{`["\q\'"]`, []string{"[", `\q\'`, "]"}, false},
+		{`["it's"]`, []string{"[", "it's", "]"}, false},
+		{`["// and /*"]`, []string{"[", "// and /*", "]"}, false},
+		{"[\"中文\xff\"]", []string{"[", "中文\xff", "]"}, false},
+		{`["a"="b"]`, []string{"[", "a", "=", "b", "]"}, false},
+		// errors
+		{`["unterminated]`, nil, true},
+		{`["unterminated\"]`, nil, true},
+		{`["unterminated\`, nil, true},
+	}
+
+	for _, test := range tests {
+		tokens, err := lex(test.line)
+		if test.err {
+			assert.NotNil(t, err, test.line)
+			continue
+		}
+		assert.Nil(t, err, test.line)
+		texts := []string{}
+		for _, tok := range tokens {
+			texts = append(texts, tok.text)
+		}
+		assert.Equal(t, test.tokens, texts, test.line)
+	}
+}
+
+func TestLexTokenTypes(t *testing.T) {
+	tokens, err := lex(`["]"=x]`)
+	assert.Nil(t, err)
+	assert.Equal(t, []token{
+		{typ: TokenTypeLBracket, text: "[", raw: "[", pos: 0},
+		{typ: TokenTypeString, text: "]", raw: `"]"`, pos: 1, quoted: true},
+		{typ: TokenTypeEQ, text: "=", raw: "=", pos: 4},
+		{typ: TokenTypeString, text: "x", raw: "x", pos: 5},
+		{typ: TokenTypeRBracket, text: "]", raw: "]", pos: 6},
+	}, tokens)
+
+	_, err = lex(`[a] ["unterminated]`)
+	assert.Equal(t, 6, err.Column)
+	assert.Equal(t, `"unterminated]`, err.Token)
+}
+
+func TestParseConformance(t *testing.T) {
+	tests := []struct {
+		line    string
+		message string
+		fields  []LogField
+		err     bool
+	}{
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [msg]`, "msg", []LogField{}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] []`, "", []LogField{}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [""]`, "", []LogField{}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [unquoted message with spaces] [k=v]`, "unquoted message with spaces", []LogField{{"k", "v"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["]"] ["="="]"]`, "]", []LogField{{"=", "]"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [sql="select '/*' from t -- it's"]`, "m", []LogField{{"sql", "select '/*' from t -- it's"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [err="[kv:9007]Write conflict, txnStartTS=1"]`, "m", []LogField{{"err", "[kv:9007]Write conflict, txnStartTS=1"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [stack="a\n\tb"]`, "m", []LogField{{"stack", "a\n\tb"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [k=v`, "", nil, true},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [k=v=w]`, "", nil, true},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [m] [[k=v]]`, "", nil, true},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [a "b"]`, `a "b"`, []LogField{}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [ID=1] [=v]`, "", []LogField{{"ID", "1"}, {"", "v"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [=v]`, "", []LogField{{"", "v"}}, false},
+		{`[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] ["a" "b"]`, "", nil, true},
+	}
+
+	for _, test := range tests {
+		l, err := parseEntry(test.line)
+		if test.err {
+			assert.NotNil(t, err, test.line)
+			continue
+		}
+		assert.Nil(t, err, test.line)
+		assert.Equal(t, test.message, l.Message, test.line)
+		assert.Equal(t, test.fields, l.Fields, test.line)
+	}
+}
@@ -15,6 +15,7 @@
 package parser
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -22,6 +23,7 @@ import (
 type LogLevel string
 
 const (
+	LogLevelTrace LogLevel = "TRACE"
 	LogLevelDebug LogLevel = "DEBUG"
 	LogLevelInfo  LogLevel = "INFO"
 	LogLevelWarn  LogLevel = "WARN"
@@ -49,5 +51,40 @@ type LogField struct {
 type LogEntry struct {
 	Header  LogHeader
 	Message string
-	Fields  []LogField // TODO: considering hashmap
+	Fields  []LogField // see Get and the typed accessors for lookup
+
+	// Continuation holds the lines following the log which don't start
+	// with a log header, eg. the stack trace of a panic. It's only filled
+	// when the StreamParser works in multi-line mode.
+	Continuation []string
+
+	// Truncated tells if the log is longer than the max line size or its
+	// continuation lines are longer than the max continuation size of the
+	// StreamParser, the fields and continuation lines beyond are dropped.
+	Truncated bool
+
+	// Container is the metadata of the container the log comes from, it's
+	// only filled in the container mode of StreamParser.
+	Container *ContainerMeta
+
+	// Position tells where the log comes from, it's nil unless the
+	// parser is asked to keep it.
+	Position *LogPosition
+}
+
+// LogPosition defines the position of one log in its source.
+type LogPosition struct {
+	Source string // eg. the file name, empty if unknown
+	Line   int    // 1-based line number of the log header
+	Offset int64  // byte offset of the log header in the source
+	Raw    string // the raw line of the log header, without Continuation
+}
+
+// String returns the position as "source:line", or "line N" if the source
+// is unknown.
+func (p *LogPosition) String() string {
+	if p.Source == "" {
+		return fmt.Sprintf("line %d", p.Line)
+	}
+	return fmt.Sprintf("%s:%d", p.Source, p.Line)
 }
@@ -0,0 +1,259 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pingcap/errors"
+)
+
+// lumberjackTimeFormat is the timestamp in the name of the log files rotated
+// by lumberjack, eg. tidb-2021-12-13T20-41-00.000.log
+const lumberjackTimeFormat = "2006-01-02T15-04-05.000"
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	compressionExts = []string{".gz", ".zst", ".zstd"}
+
+	// nonUnifiedSuffixes are the suffixes of the names of the log files not
+	// in the unified log format written by the components, eg.
+	// tidb_slow_query.log and tikv_stderr.log.
+	nonUnifiedSuffixes = []string{"_slow_query", "_slow", "_stderr"}
+)
+
+// logFile is the name of a log file split according to the lumberjack
+// naming scheme.
+type logFile struct {
+	path string
+	// group is the name of the active log file, eg. tidb.log for all
+	// the files rotated from it.
+	group string
+	// rotated is the time of rotation, zero for the active file.
+	rotated time.Time
+}
+
+func newLogFile(path string) logFile {
+	dir, name := filepath.Split(path)
+	for _, ext := range compressionExts {
+		name = strings.TrimSuffix(name, ext)
+	}
+	ext := filepath.Ext(name)
+	prefix := strings.TrimSuffix(name, ext)
+	f := logFile{path: path, group: filepath.Join(dir, name)}
+	if len(prefix) > len(lumberjackTimeFormat) && prefix[len(prefix)-len(lumberjackTimeFormat)-1] == '-' {
+		ts := prefix[len(prefix)-len(lumberjackTimeFormat):]
+		if t, err := time.Parse(lumberjackTimeFormat, ts); err == nil {
+			f.rotated = t
+			f.group = filepath.Join(dir, prefix[:len(prefix)-len(ts)-1]+ext)
+		}
+	}
+	return f
+}
+
+// ListLogFiles returns the log files matched by the pattern in chronological
+// order. The pattern is either a directory, in which case all the *.log files
+// (optionally compressed) in it are returned, or a glob like tidb*.log*. The
+// files known not to be in the unified log format, eg. the slow query log
+// tidb_slow_query.log and the stderr tikv_stderr.log, are left out. The
+// files rotated by lumberjack are ordered by the time in their names and
+// followed by the active file, the files of different logs are not mixed.
+func ListLogFiles(pattern string) ([]string, error) {
+	return listFiles(pattern, isLogFileName, func(path string) bool {
+		return !isNonUnifiedLog(path)
+	})
+}
+
+// ListSlowLogFiles returns the slow query log files matched by the pattern
+// in the order of ListLogFiles. The pattern is either a directory, in which
+// case the *slow*.log files (optionally compressed) in it are returned, or a
+// glob.
+func ListSlowLogFiles(pattern string) ([]string, error) {
+	return listFiles(pattern, isSlowLogFileName, func(string) bool { return true })
+}
+
+// listFiles lists the files in the directory of the names accepted by
+// inDir, or the ones matched by the glob and accepted by inGlob, in the
+// order of ListLogFiles.
+func listFiles(pattern string, inDir, inGlob func(string) bool) ([]string, error) {
+	paths := []string{}
+	if st, err := os.Stat(pattern); err == nil && st.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() || !inDir(e.Name()) {
+				continue
+			}
+			paths = append(paths, filepath.Join(pattern, e.Name()))
+		}
+	} else {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if st, err := os.Stat(m); err == nil && !st.IsDir() && inGlob(m) {
+				paths = append(paths, m)
+			}
+		}
+	}
+	if len(paths) == 0 {
+		return nil, errors.Errorf("no log files found by %s", pattern)
+	}
+
+	files := make([]logFile, 0, len(paths))
+	for _, p := range paths {
+		files = append(files, newLogFile(p))
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].group != files[j].group {
+			return files[i].group < files[j].group
+		}
+		ri, rj := files[i].rotated, files[j].rotated
+		if ri.IsZero() || rj.IsZero() {
+			// the active file is the latest
+			return !ri.IsZero() && rj.IsZero()
+		}
+		return ri.Before(rj)
+	})
+	for i, f := range files {
+		paths[i] = f.path
+	}
+	return paths, nil
+}
+
+func isLogFileName(name string) bool {
+	for _, ext := range compressionExts {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return strings.HasSuffix(name, ".log") && !isNonUnifiedLog(name)
+}
+
+func isSlowLogFileName(name string) bool {
+	for _, ext := range compressionExts {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return strings.HasSuffix(name, ".log") && strings.Contains(name, "slow")
+}
+
+// isNonUnifiedLog tells if the file is known not to be in the unified log
+// format by its name, the rotated ones are told by the name of the active
+// file.
+func isNonUnifiedLog(path string) bool {
+	name := filepath.Base(newLogFile(path).group)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	for _, suffix := range nonUnifiedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenLogFiles creates a *StreamParser parsing the files one by one as a
+// continuous input. The compressed files (gzip or zstd) are decompressed
+// transparently, and every LogEntry carries its file name and line number
+// in Position. The files are opened on demand, the parser should be closed
+// after use.
+func OpenLogFiles(paths ...string) *StreamParser {
+	sp := NewStreamParser(bytes.NewReader(nil))
+	sp.positions = true
+	sp.sources = func() (io.ReadCloser, string, error) {
+		if len(paths) == 0 {
+			return nil, "", io.EOF
+		}
+		path := paths[0]
+		paths = paths[1:]
+		r, err := OpenLogFile(path)
+		return r, path, err
+	}
+	return sp
+}
+
+// OpenLogSet opens the log files matched by the pattern in the order of
+// ListLogFiles as one *StreamParser.
+func OpenLogSet(pattern string) (*StreamParser, error) {
+	paths, err := ListLogFiles(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return OpenLogFiles(paths...), nil
+}
+
+// OpenLogFile opens the file and decompresses it if it's compressed (gzip
+// or zstd), it's for reading the files of other formats in a log set, eg.
+// the slow query log.
+func OpenLogFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// decompress detects the compression of rc by its magic number.
+func decompress(rc io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(rc)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{gr, func() error {
+			gr.Close()
+			return rc.Close()
+		}}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &readCloser{zr, func() error {
+			zr.Close()
+			return rc.Close()
+		}}, nil
+	default:
+		return &readCloser{br, rc.Close}, nil
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc *readCloser) Close() error {
+	return rc.close()
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeLogFile(t *testing.T, path string, compression string, messages ...string) {
+	buf := bytes.Buffer{}
+	for _, msg := range messages {
+		fmt.Fprintf(&buf, "[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:1] [%s]\n", msg)
+	}
+	data := buf.Bytes()
+	switch compression {
+	case "gzip":
+		out := bytes.Buffer{}
+		w := gzip.NewWriter(&out)
+		_, err := w.Write(data)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+		data = out.Bytes()
+	case "zstd":
+		out := bytes.Buffer{}
+		w, err := zstd.NewWriter(&out)
+		assert.Nil(t, err)
+		_, err = w.Write(data)
+		assert.Nil(t, err)
+		assert.Nil(t, w.Close())
+		data = out.Bytes()
+	}
+	assert.Nil(t, os.WriteFile(path, data, 0644))
+}
+
+func TestLogSet(t *testing.T) {
+	dir := t.TempDir()
+	writeLogFile(t, filepath.Join(dir, "tidb.log"), "", "4", "5")
+	writeLogFile(t, filepath.Join(dir, "tidb-2021-12-13T20-41-00.000.log.gz"), "gzip", "3")
+	writeLogFile(t, filepath.Join(dir, "tidb-2021-12-12T08-00-00.000.log"), "zstd", "2")
+	writeLogFile(t, filepath.Join(dir, "tidb-2021-12-01T08-00-00.000.log"), "", "1")
+	writeLogFile(t, filepath.Join(dir, "pd.log"), "", "pd")
+	writeLogFile(t, filepath.Join(dir, "tidb.toml"), "", "not a log")
+	writeLogFile(t, filepath.Join(dir, "tidb_slow_query.log"), "", "slow")
+	writeLogFile(t, filepath.Join(dir, "tidb_slow_query-2021-12-01T08-00-00.000.log.gz"), "gzip", "slow")
+	writeLogFile(t, filepath.Join(dir, "tidb_stderr.log"), "", "stderr")
+
+	paths, err := ListLogFiles(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "pd.log"),
+		filepath.Join(dir, "tidb-2021-12-01T08-00-00.000.log"),
+		filepath.Join(dir, "tidb-2021-12-12T08-00-00.000.log"),
+		filepath.Join(dir, "tidb-2021-12-13T20-41-00.000.log.gz"),
+		filepath.Join(dir, "tidb.log"),
+	}, paths)
+	paths, err = ListSlowLogFiles(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "tidb_slow_query-2021-12-01T08-00-00.000.log.gz"),
+		filepath.Join(dir, "tidb_slow_query.log"),
+	}, paths)
+	paths, err = ListSlowLogFiles(filepath.Join(dir, "tidb_slow_query*"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(paths))
+
+	sp, err := OpenLogSet(filepath.Join(dir, "tidb*"))
+	assert.Nil(t, err)
+	defer sp.Close()
+	logs, _, err := sp.ReadAll()
+	assert.Nil(t, err)
+	msgs := []string{}
+	for _, l := range logs {
+		msgs = append(msgs, l.Message)
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4", "5", "not a log"}, msgs)
+	assert.Equal(t, &LogPosition{
+		Source: filepath.Join(dir, "tidb-2021-12-13T20-41-00.000.log.gz"),
+		Line:   1,
+		Offset: 0,
+		Raw:    "[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:1] [3]",
+	}, logs[2].Position)
+	assert.Equal(t, &LogPosition{
+		Source: filepath.Join(dir, "tidb.log"),
+		Line:   2,
+		Offset: 56,
+		Raw:    "[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:1] [5]",
+	}, logs[4].Position)
+
+	_, err = OpenLogSet(filepath.Join(dir, "tikv*"))
+	assert.NotNil(t, err)
+
+	// a missing file is reported when it's reached
+	sp = OpenLogFiles(filepath.Join(dir, "pd.log"), filepath.Join(dir, "missing.log"))
+	l, err := sp.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "pd", l.Message)
+	_, err = sp.Next()
+	assert.NotNil(t, err)
+	assert.Nil(t, sp.Close())
+
+	// the malformed lines are located in the file
+	malformed := filepath.Join(dir, "malformed.log")
+	assert.Nil(t, os.WriteFile(malformed, []byte("malformed\n"), 0644))
+	sp = OpenLogFiles(malformed)
+	_, err = sp.Next()
+	perr, ok := err.(*ParseError)
+	assert.True(t, ok)
+	assert.Equal(t, malformed, perr.Source)
+	assert.Equal(t, 1, perr.Line)
+	assert.Equal(t, malformed+" at line 1, column 1: "+perr.Err.Error(), perr.Error())
+	assert.Nil(t, sp.Close())
+}
+
+func TestTruncatedArchive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tidb-2021-12-13T20-41-00.000.log.gz")
+	writeLogFile(t, path, "gzip", "1", "2", "3")
+	data, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(path, data[:len(data)-10], 0644))
+	writeLogFile(t, filepath.Join(dir, "tidb.log"), "", "4")
+
+	// the read error is returned once and then the next file is read
+	sp := OpenLogFiles(path, filepath.Join(dir, "tidb.log"))
+	defer sp.Close()
+	msgs, errs := []string{}, 0
+	for i := 0; i < 100; i++ {
+		l, err := sp.Next()
+		if l == nil && err == nil {
+			break
+		}
+		if err != nil {
+			_, ok := err.(*ParseError)
+			assert.False(t, ok)
+			assert.Contains(t, err.Error(), path)
+			errs++
+			continue
+		}
+		msgs = append(msgs, l.Message)
+	}
+	assert.Equal(t, 1, errs)
+	assert.Equal(t, "4", msgs[len(msgs)-1])
+	l, err := sp.Next()
+	assert.Nil(t, l)
+	assert.Nil(t, err)
+
+	// a single input ends after the error
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.Nil(t, err)
+	sp = NewStreamParser(r)
+	for err == nil {
+		_, err = sp.Next()
+	}
+	l, err = sp.Next()
+	assert.Nil(t, l)
+	assert.Nil(t, err)
+}
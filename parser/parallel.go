@@ -0,0 +1,369 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// DefaultChunkSize is the default size of the chunks parsed by ParallelParser.
+const DefaultChunkSize = 4 * 1024 * 1024
+
+// ParallelParser parses a seekable input, eg. a large log file, with
+// multiple goroutines. The input is split into line-aligned chunks which
+// are parsed by one StreamParser each, and the entries are returned in the
+// original order unless the parser is unordered.
+type ParallelParser struct {
+	r         io.ReaderAt
+	size      int64
+	workers   int
+	chunkSize int64
+	unordered bool
+	config    func(*StreamParser) *StreamParser
+
+	// Seq is the sequence number of the entry or error last returned by
+	// Next, which is its byte offset in the input. It's increasing in the
+	// original order of the input.
+	Seq int64
+	// Line is the line number of the entry or error last returned by Next,
+	// it's always 0 in unordered mode.
+	Line int
+	// Errors collects the malformed lines skipped in lenient mode.
+	Errors []*ParseError
+
+	once    sync.Once
+	done    chan struct{}
+	order   chan *chunk
+	results chan *chunk
+	cur     *chunk
+	lines   int // number of lines before the current chunk
+}
+
+// chunk is a line-aligned part of the input.
+type chunk struct {
+	start, end int64
+	err        error // error of splitting the input
+	result     chan *chunk
+
+	items  []chunkItem
+	errors []*ParseError
+	lines  int
+	next   int
+}
+
+type chunkItem struct {
+	log    *LogEntry
+	err    error
+	line   int
+	offset int64
+}
+
+// NewParallelParser creates a *ParallelParser reading size bytes from r.
+func NewParallelParser(r io.ReaderAt, size int64) *ParallelParser {
+	return &ParallelParser{
+		r:         r,
+		size:      size,
+		workers:   runtime.NumCPU(),
+		chunkSize: DefaultChunkSize,
+		config: func(sp *StreamParser) *StreamParser {
+			return sp
+		},
+		done: make(chan struct{}),
+	}
+}
+
+// WithWorkers sets the number of parsing goroutines, it's the number of
+// CPUs by default.
+func (pp *ParallelParser) WithWorkers(n int) *ParallelParser {
+	if n > 0 {
+		pp.workers = n
+	}
+	return pp
+}
+
+// WithChunkSize sets the approximate size of the chunks.
+func (pp *ParallelParser) WithChunkSize(n int64) *ParallelParser {
+	if n > 0 {
+		pp.chunkSize = n
+	}
+	return pp
+}
+
+// WithConfig sets the function to configure the StreamParser of every
+// chunk, eg. to parse in multi-line mode:
+//
+//	pp.WithConfig(func(sp *StreamParser) *StreamParser {
+//		return sp.WithMultiline(0)
+//	})
+//
+// The Position filled by sp.WithPosition() is relative to the whole input,
+// and its Line is 0 in unordered mode like pp.Line.
+func (pp *ParallelParser) WithConfig(config func(*StreamParser) *StreamParser) *ParallelParser {
+	pp.config = config
+	return pp
+}
+
+// Unordered makes the parser return the entries as soon as their chunk is
+// parsed, the original order can be restored by pp.Seq.
+func (pp *ParallelParser) Unordered() *ParallelParser {
+	pp.unordered = true
+	return pp
+}
+
+// Next returns the next LogEntry, it returns (nil, nil) at the end of the
+// input. Like StreamParser, a malformed line is returned as *ParseError.
+func (pp *ParallelParser) Next() (*LogEntry, error) {
+	pp.once.Do(pp.start)
+	for {
+		if pp.cur != nil && pp.cur.next < len(pp.cur.items) {
+			item := pp.cur.items[pp.cur.next]
+			pp.cur.next++
+			pp.Seq = item.offset
+			pp.Line = 0
+			if !pp.unordered {
+				pp.Line = pp.lines + item.line
+			}
+			if perr, ok := item.err.(*ParseError); ok {
+				pp.locate(pp.cur, perr)
+			}
+			if item.log != nil && item.log.Position != nil {
+				item.log.Position.Line = pp.Line
+				item.log.Position.Offset = pp.Seq
+			}
+			return item.log, item.err
+		}
+		if pp.cur != nil {
+			for _, perr := range pp.cur.errors {
+				pp.locate(pp.cur, perr)
+			}
+			pp.Errors = append(pp.Errors, pp.cur.errors...)
+			pp.lines += pp.cur.lines
+			pp.cur = nil
+		}
+		c := pp.nextChunk()
+		if c == nil {
+			return nil, nil
+		}
+		pp.cur = c
+	}
+}
+
+// ReadAll parses all the remaining entries like StreamParser.ReadAll.
+func (pp *ParallelParser) ReadAll() ([]*LogEntry, []*ParseError, error) {
+	logs := []*LogEntry{}
+	for {
+		log, err := pp.Next()
+		if err != nil {
+			pp.Close()
+			return nil, nil, err
+		}
+		if log == nil {
+			return logs, pp.Errors, nil
+		}
+		logs = append(logs, log)
+	}
+}
+
+// Close stops the parsing goroutines, it's only needed if Next is not
+// called until the end of the input.
+func (pp *ParallelParser) Close() {
+	pp.once.Do(func() {})
+	select {
+	case <-pp.done:
+	default:
+		close(pp.done)
+	}
+}
+
+// locate converts the chunk relative position of perr to the input one.
+func (pp *ParallelParser) locate(c *chunk, perr *ParseError) {
+	perr.Offset += c.start
+	if pp.unordered {
+		perr.Line = 0
+	} else {
+		perr.Line += pp.lines
+	}
+}
+
+func (pp *ParallelParser) nextChunk() *chunk {
+	var c *chunk
+	var ok bool
+	select {
+	case c, ok = <-pp.order:
+	case <-pp.done:
+	}
+	if !ok || pp.unordered {
+		return c
+	}
+	select {
+	case c = <-c.result:
+		return c
+	case <-pp.done:
+		return nil
+	}
+}
+
+func (pp *ParallelParser) start() {
+	jobs := make(chan *chunk, pp.workers)
+	pp.order = make(chan *chunk, pp.workers*2)
+	if pp.unordered {
+		// the chunks are sent by the workers as soon as they're parsed
+		pp.results = pp.order
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(pp.workers)
+	for i := 0; i < pp.workers; i++ {
+		go func() {
+			defer wg.Done()
+			pp.work(jobs)
+		}()
+	}
+	go pp.dispatch(jobs)
+	if pp.unordered {
+		go func() {
+			wg.Wait()
+			close(pp.order)
+		}()
+	}
+}
+
+// dispatch splits the input into chunks and sends them to the workers.
+func (pp *ParallelParser) dispatch(jobs chan<- *chunk) {
+	defer close(jobs)
+	if !pp.unordered {
+		defer close(pp.order)
+	}
+
+	proto := pp.config(NewStreamParser(strings.NewReader("")))
+	for start := int64(0); start < pp.size; {
+		end, err := pp.boundary(proto, start+pp.chunkSize)
+		c := &chunk{start: start, end: end, err: err, result: make(chan *chunk, 1)}
+		if err != nil {
+			c.end = pp.size
+		}
+		start = c.end
+		if !pp.unordered {
+			select {
+			case pp.order <- c:
+			case <-pp.done:
+				return
+			}
+		}
+		select {
+		case jobs <- c:
+		case <-pp.done:
+			return
+		}
+	}
+}
+
+// boundary returns the offset of the first entry starting at or after pos.
+func (pp *ParallelParser) boundary(proto *StreamParser, pos int64) (int64, error) {
+	if pos >= pp.size {
+		return pp.size, nil
+	}
+	r := bufio.NewReader(io.NewSectionReader(pp.r, pos, pp.size-pos))
+	// skip the rest of the line containing pos
+	_, n, err := readLinePrefix(r)
+	pos += n
+	if err != nil {
+		if err == io.EOF {
+			return pp.size, nil
+		}
+		return 0, err
+	}
+	// in multi-line mode the chunk must end before an entry, and in container
+	// mode it must not end before a partial line is finished, which is unknown
+	// for the line containing pos
+	known, partial := !proto.containers, false
+	for {
+		prefix, n, err := readLinePrefix(r)
+		text := strings.TrimRight(prefix, "\r\n")
+		unfinished := false
+		if proto.containers {
+			text, _, unfinished = unwrapContainer(text)
+		}
+		if known && !partial && (!proto.multiline || proto.isEntryStart(text) && proto.parsesHeader(text, n > int64(len(prefix)))) {
+			return pos, nil
+		}
+		known, partial = true, unfinished
+		pos += n
+		if err != nil {
+			if err == io.EOF {
+				return pp.size, nil
+			}
+			return 0, err
+		}
+	}
+}
+
+// readLinePrefix reads one line and returns its beginning and length, so
+// that an over-long line is not buffered entirely.
+func readLinePrefix(r *bufio.Reader) (string, int64, error) {
+	prefix := ""
+	n := int64(0)
+	for {
+		data, err := r.ReadSlice('\n')
+		if n == 0 {
+			prefix = string(data)
+		}
+		n += int64(len(data))
+		if err != bufio.ErrBufferFull {
+			return prefix, n, err
+		}
+	}
+}
+
+func (pp *ParallelParser) work(jobs <-chan *chunk) {
+	for c := range jobs {
+		pp.parse(c)
+		result := c.result
+		if pp.unordered {
+			result = pp.results
+		}
+		select {
+		case result <- c:
+		case <-pp.done:
+			return
+		}
+	}
+}
+
+func (pp *ParallelParser) parse(c *chunk) {
+	if c.err != nil {
+		c.items = append(c.items, chunkItem{err: c.err, offset: c.start})
+		return
+	}
+	sp := pp.config(NewStreamParser(io.NewSectionReader(pp.r, c.start, c.end-c.start)))
+	for {
+		log, err := sp.Next()
+		if log == nil && err == nil {
+			break
+		}
+		if _, ok := err.(*ParseError); err != nil && !ok {
+			// io error, stop parsing the chunk
+			c.items = append(c.items, chunkItem{err: err, line: sp.Line, offset: c.start + sp.consumed})
+			break
+		}
+		c.items = append(c.items, chunkItem{log: log, err: err, line: sp.Line, offset: c.start + sp.offset})
+	}
+	c.errors = sp.Errors
+	c.lines = sp.read
+}
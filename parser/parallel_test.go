@@ -0,0 +1,180 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// genLogs generates n lines of logs, every 100th line is malformed and every
+// 10th entry has a stack trace if multiline is set.
+func genLogs(n int, multiline bool) string {
+	b := strings.Builder{}
+	for i := 0; i < n; i++ {
+		if i%100 == 99 {
+			b.WriteString("<invalid line>\n")
+			continue
+		}
+		fmt.Fprintf(&b, `[2021/12/16 17:03:48.%03d +08:00] [INFO] [region_cache.go:%d] ["mark store's regions need be refill"] [id=%d] [addr=127.0.0.1:20160] [sql="select * from t where a = '%d'"]`+"\n", i%1000, i, i, i)
+		if multiline && i%10 == 0 {
+			b.WriteString("goroutine 1 [running]:\n\tmain.go:1 +0x1\n")
+		}
+	}
+	return b.String()
+}
+
+func TestParallelParser(t *testing.T) {
+	for _, multiline := range []bool{false, true} {
+		config := func(sp *StreamParser) *StreamParser {
+			sp = sp.WithPosition()
+			if multiline {
+				sp = sp.WithMultiline(0)
+			}
+			return sp
+		}
+		input := genLogs(2000, multiline)
+		expected, expectedErrs, err := config(NewStreamParser(strings.NewReader(input))).Lenient().ReadAll()
+		assert.Nil(t, err)
+		if multiline {
+			// the invalid lines are continuations in multi-line mode
+			assert.Equal(t, 0, len(expectedErrs))
+		} else {
+			assert.Equal(t, 20, len(expectedErrs))
+		}
+
+		// ordered
+		pp := NewParallelParser(strings.NewReader(input), int64(len(input))).WithWorkers(4).WithChunkSize(1000).WithConfig(config)
+		logs := []*LogEntry{}
+		errLines := []int{}
+		for {
+			l, err := pp.Next()
+			if l == nil && err == nil {
+				break
+			}
+			if err != nil {
+				perr := err.(*ParseError)
+				assert.Equal(t, "<invalid line>", perr.Raw)
+				assert.Equal(t, perr.Line, pp.Line)
+				assert.Equal(t, "<invalid line>", input[perr.Offset:perr.Offset+14])
+				errLines = append(errLines, perr.Line)
+				continue
+			}
+			logs = append(logs, l)
+		}
+		assert.Equal(t, expected, logs)
+		assert.Equal(t, len(expectedErrs), len(errLines))
+		if !multiline {
+			assert.Equal(t, 100, errLines[0])
+			assert.Equal(t, 2000, errLines[19])
+		}
+
+		// unordered
+		pp = NewParallelParser(strings.NewReader(input), int64(len(input))).WithWorkers(4).WithChunkSize(1000).WithConfig(config).Unordered()
+		seqs := map[*LogEntry]int64{}
+		logs = []*LogEntry{}
+		for {
+			l, err := pp.Next()
+			if l == nil && err == nil {
+				break
+			}
+			if err != nil {
+				continue
+			}
+			seqs[l] = pp.Seq
+			assert.Equal(t, 0, l.Position.Line)
+			assert.Equal(t, pp.Seq, l.Position.Offset)
+			logs = append(logs, l)
+		}
+		sort.Slice(logs, func(i, j int) bool {
+			return seqs[logs[i]] < seqs[logs[j]]
+		})
+		for i, l := range logs {
+			// the line numbers are unknown in unordered mode
+			l.Position.Line = expected[i].Position.Line
+		}
+		assert.Equal(t, expected, logs)
+
+		// lenient
+		logs, errs, err := NewParallelParser(strings.NewReader(input), int64(len(input))).WithChunkSize(1000).WithConfig(func(sp *StreamParser) *StreamParser {
+			return config(sp).Lenient()
+		}).ReadAll()
+		assert.Nil(t, err)
+		assert.Equal(t, expected, logs)
+		assert.Equal(t, expectedErrs, errs)
+		for _, perr := range errs {
+			assert.Equal(t, "<invalid line>", input[perr.Offset:perr.Offset+14])
+		}
+	}
+}
+
+func TestParallelParserClose(t *testing.T) {
+	input := genLogs(2000, false)
+	pp := NewParallelParser(strings.NewReader(input), int64(len(input))).WithWorkers(2).WithChunkSize(100)
+	l, err := pp.Next()
+	assert.Nil(t, err)
+	assert.NotNil(t, l)
+	pp.Close()
+	for l != nil || err != nil {
+		l, err = pp.Next()
+	}
+}
+
+// The throughput of ParallelParser scales with GOMAXPROCS, compare them with
+// go test -run XXX -bench Parse -cpu 1,4,8
+func BenchmarkParseFromReader(b *testing.B) {
+	input := genLogs(100000, false)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := ParseFromReaderLenient(strings.NewReader(input)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParallelParser(b *testing.B) {
+	input := genLogs(100000, false)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pp := NewParallelParser(strings.NewReader(input), int64(len(input)))
+		for {
+			l, err := pp.Next()
+			if l == nil && err == nil {
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParallelParserUnordered(b *testing.B) {
+	input := genLogs(100000, false)
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pp := NewParallelParser(strings.NewReader(input), int64(len(input))).Unordered()
+		for {
+			l, err := pp.Next()
+			if l == nil && err == nil {
+				break
+			}
+		}
+	}
+}
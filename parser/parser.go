@@ -15,12 +15,10 @@
 package parser
 
 import (
-	"bufio"
 	"bytes"
 	"io"
 	"strconv"
 	"strings"
-	"text/scanner"
 	"time"
 )
 
@@ -29,7 +27,7 @@ import (
 //	DateTime 	= <string>
 //	LogLevel	= "DEBUG" | "INFO" | "WARN" | "ERROR" | "FATAL"
 //	FileLine	= <string>
-//	Message		= '[', <string>, ']'
+//	Message		= ['[', [<string>], ']']
 //	LogFields	= {LogField}
 //	LogField	= '[', [<string>], '=', [<string>], ']' | '[', ']'
 
@@ -44,7 +42,24 @@ const (
 )
 
 type Parser struct {
-	tokens []string
+	tokens []token
+	// last is the token being parsed, for locating errors
+	last token
+	// eol is the length of the line
+	eol int
+	// times parses the datetime, DefaultTimeLayouts are used if it's nil
+	times *timeParser
+	// partial parses a truncated line, which ends anywhere after the header
+	partial bool
+}
+
+// token is one lexical token of a log line.
+type token struct {
+	typ    TokenType
+	text   string // the decoded text
+	raw    string // the text in the line
+	pos    int    // byte offset in the line
+	quoted bool
 }
 
 // Input: "[", "2021/12/13 20:41:00.755 +08:00", "]", "[", "INFO","]", "[", "store.go:68", "]", "[", "new store", "]", "[", "path", "=", "unistore:///tmp/tidb", "]"
@@ -62,33 +77,40 @@ type Parser struct {
 //        Value: "unistore:///tmp/tidb"
 //      }]
 //    }
+//
+// The returned error is a *ParseError locating the offending token.
 func (p *Parser) Parse() (*LogEntry, error) {
 	datetime, err := p.parseDateTime()
 	if err != nil {
-		return nil, err
+		return nil, p.error(err)
 	}
 	level, err := p.parseLogLevel()
 	if err != nil {
-		return nil, err
+		return nil, p.error(err)
 	}
 	file, line, err := p.parseFileLine()
 	if err != nil {
-		return nil, err
+		return nil, p.error(err)
 	}
+	fields := []LogField{}
 	message, err := p.parseMessage()
 	if err != nil {
-		return nil, err
+		if !p.truncated(err) {
+			return nil, p.error(err)
+		}
+		p.tokens = nil
 	}
-	fields := []LogField{}
 	for len(p.tokens) > 0 {
 		field, err := p.parseLogField()
-		if err != nil {
-			return nil, err
+		if err != nil && !p.truncated(err) {
+			return nil, p.error(err)
 		}
-		if field == nil {
-			continue
+		if field != nil {
+			fields = append(fields, *field)
+		}
+		if err != nil {
+			break
 		}
-		fields = append(fields, *field)
 	}
 	return &LogEntry{
 		Header: LogHeader{
@@ -110,7 +132,10 @@ func (p *Parser) parseDateTime() (time.Time, error) {
 	if err != nil {
 		return time.Time{}, err
 	}
-	datetime, err := time.Parse(TiDBTimeFormat, tok)
+	if p.times == nil {
+		p.times = defaultTimeParser()
+	}
+	datetime, err := p.times.parse(tok)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -130,27 +155,15 @@ func (p *Parser) parseLogLevel() (LogLevel, error) {
 	if err != nil {
 		return "", err
 	}
-	_, err = p.expect(TokenTypeRBracket)
+	level, err := parseLogLevel(tok)
 	if err != nil {
 		return "", err
 	}
-	switch tok {
-	case string(LogLevelDebug):
-		return LogLevelDebug, nil
-	case string(LogLevelInfo):
-		return LogLevelInfo, nil
-	case string(LogLevelWarn):
-		return LogLevelWarn, nil
-	case string(LogLevelError):
-		return LogLevelError, nil
-	case string(LogLevelFatal):
-		return LogLevelFatal, nil
-	default:
-		return "", &UnexpectedTokenError{
-			ExpectedToken: "LogLevel",
-			GotToken:      tok,
-		}
+	_, err = p.expect(TokenTypeRBracket)
+	if err != nil {
+		return "", err
 	}
+	return level, nil
 }
 
 func (p *Parser) parseFileLine() (string, uint, error) {
@@ -162,39 +175,84 @@ func (p *Parser) parseFileLine() (string, uint, error) {
 	if err != nil {
 		return "", 0, err
 	}
+	file, line, err := parseFileLine(tok)
+	if err != nil {
+		return "", 0, err
+	}
 	_, err = p.expect(TokenTypeRBracket)
 	if err != nil {
 		return "", 0, err
 	}
+	return file, line, nil
+}
+
+// parseLogLevel parses the log level, the legacy spellings of it, eg.
+// "warning" and the abbreviations of slog, are accepted too.
+func parseLogLevel(tok string) (LogLevel, error) {
+	switch strings.ToUpper(tok) {
+	case string(LogLevelTrace), "TRCE":
+		return LogLevelTrace, nil
+	case string(LogLevelDebug), "DEBG":
+		return LogLevelDebug, nil
+	case string(LogLevelInfo):
+		return LogLevelInfo, nil
+	case string(LogLevelWarn), "WARNING":
+		return LogLevelWarn, nil
+	case string(LogLevelError), "ERRO":
+		return LogLevelError, nil
+	case string(LogLevelFatal), "CRIT", "CRITICAL", "PANIC", "DPANIC":
+		return LogLevelFatal, nil
+	default:
+		return "", &UnexpectedTokenError{
+			ExpectedToken: "LogLevel",
+			GotToken:      tok,
+		}
+	}
+}
+
+// parseFileLine splits "file:line" into file and line, the file may contain
+// ':' like C:\main.go.
+func parseFileLine(tok string) (string, uint, error) {
 	if tok == "<unknown>" {
 		return tok, 0, nil
 	}
-	xs := strings.Split(tok, ":")
-	if len(xs) != 2 {
+	i := strings.LastIndex(tok, ":")
+	if i < 0 {
 		return "", 0, &UnexpectedTokenError{
 			ExpectedToken: ":",
 			GotToken:      "]",
 		}
 	}
-	line, err := strconv.Atoi(xs[1])
+	line, err := strconv.Atoi(tok[i+1:])
 	if err != nil {
 		return "", 0, err
 	}
-	return xs[0], uint(line), nil
+	return tok[:i], uint(line), nil
 }
 
 func (p *Parser) parseMessage() (string, error) {
+	// a log without message, eg. of the audit plugin, goes on with the fields
+	if len(p.tokens) > 2 && p.tokens[0].typ == TokenTypeLBracket &&
+		(p.tokens[1].typ == TokenTypeEQ || p.tokens[1].typ == TokenTypeString && p.tokens[2].typ == TokenTypeEQ) {
+		return "", nil
+	}
 	_, err := p.expect(TokenTypeLBracket)
 	if err != nil {
 		return "", err
 	}
+	// "[]", empty message
+	if len(p.tokens) > 0 && p.tokens[0].typ == TokenTypeRBracket {
+		p.skip()
+		return "", nil
+	}
 	tok, err := p.expect(TokenTypeString)
 	if err != nil {
 		return "", err
 	}
 	_, err = p.expect(TokenTypeRBracket)
 	if err != nil {
-		return "", err
+		// the message parsed so far is kept for a truncated line
+		return tok, err
 	}
 	return tok, nil
 }
@@ -214,14 +272,18 @@ func (p *Parser) parseLogField() (*LogField, error) {
 		return nil, err
 	}
 	p.skip()
-	if tok == string(TokenTypeRBracket) {
+	if tok.typ == TokenTypeRBracket {
 		// "[]", empty log filed, returns empty field
 		return nil, nil
-	} else if tok != string(TokenTypeEQ) {
+	} else if tok.typ != TokenTypeEQ {
 		// "[name=xxx]""
-		if name, err = unquote(tok); err != nil {
-			return nil, err
+		if tok.typ != TokenTypeString {
+			return nil, &UnexpectedTokenError{
+				ExpectedToken: string(TokenTypeString),
+				GotToken:      tok.raw,
+			}
 		}
+		name = tok.text
 		if _, err = p.expect(TokenTypeEQ); err != nil {
 			return nil, err
 		}
@@ -233,13 +295,18 @@ func (p *Parser) parseLogField() (*LogField, error) {
 		return nil, err
 	}
 	p.skip()
-	if tok != string(TokenTypeRBracket) {
-		if value, err = unquote(tok); err != nil {
-			return nil, err
+	if tok.typ != TokenTypeRBracket {
+		if tok.typ != TokenTypeString {
+			return nil, &UnexpectedTokenError{
+				ExpectedToken: string(TokenTypeString),
+				GotToken:      tok.raw,
+			}
 		}
+		value = tok.text
 		_, err = p.expect(TokenTypeRBracket)
 		if err != nil {
-			return nil, err
+			// the field parsed so far is kept for a truncated line
+			return &LogField{Name: name, Value: value}, err
 		}
 	}
 
@@ -250,34 +317,33 @@ func (p *Parser) parseLogField() (*LogField, error) {
 }
 
 // expect check if p.tokens[0] is expected token and pop it
-func (p *Parser) expect(token TokenType) (string, error) {
+func (p *Parser) expect(tp TokenType) (string, error) {
 	if len(p.tokens) == 0 {
+		p.last = token{pos: p.eol}
 		return "", &UnexpectedEOLError{
-			ExpectedToken: string(token),
+			ExpectedToken: string(tp),
 		}
 	}
 	top := p.tokens[0]
+	p.last = top
 	p.tokens = p.tokens[1:]
-	var err error
-	if token == TokenTypeString {
-		if top, err = unquote(top); err != nil {
-			return "", err
-		}
-	} else if top != string(token) {
+	if top.typ != tp {
 		return "", &UnexpectedTokenError{
-			ExpectedToken: string(token),
-			GotToken:      top,
+			ExpectedToken: string(tp),
+			GotToken:      top.raw,
 		}
 	}
-	return top, nil
+	return top.text, nil
 }
 
-func (p *Parser) peek() (string, error) {
+func (p *Parser) peek() (token, error) {
 	if len(p.tokens) == 0 {
-		return "", &UnexpectedEOLError{
+		p.last = token{pos: p.eol}
+		return token{}, &UnexpectedEOLError{
 			ExpectedToken: "<token>",
 		}
 	}
+	p.last = p.tokens[0]
 	return p.tokens[0], nil
 }
 
@@ -285,6 +351,21 @@ func (p *Parser) skip() {
 	p.tokens = p.tokens[1:]
 }
 
+// truncated tells if err is caused by the end of a truncated line.
+func (p *Parser) truncated(err error) bool {
+	_, ok := err.(*UnexpectedEOLError)
+	return p.partial && ok
+}
+
+// error locates err at the token being parsed.
+func (p *Parser) error(err error) *ParseError {
+	return &ParseError{
+		Column: p.last.pos + 1,
+		Token:  p.last.raw,
+		Err:    err,
+	}
+}
+
 // ParseFromBytes parses a byte slice as *LogEntry slice.
 func ParseFromBytes(r []byte) ([]*LogEntry, error) {
 	return ParseFromReader(bytes.NewReader(r))
@@ -296,47 +377,64 @@ func ParseFromString(r string) ([]*LogEntry, error) {
 }
 
 // ParseFromReader parses a byte stream from io.Reader as *LogEntry slice.
-// The function continues to run until the reader returns io.EOF.
+// The function continues to run until the reader returns io.EOF, it stops
+// at the first malformed line and returns a *ParseError.
 func ParseFromReader(lr io.Reader) ([]*LogEntry, error) {
-	logs := []*LogEntry{}
-	sc := bufio.NewScanner(lr)
-	for sc.Scan() {
-		tokens := parseLine(sc.Text())
-		if len(tokens) == 0 {
-			continue
-		}
-		p := Parser{tokens: tokens}
-		log, err := p.Parse()
-		if err != nil {
-			return nil, err
-		}
-		logs = append(logs, log)
-	}
-	return logs, nil
+	logs, _, err := NewStreamParser(lr).ReadAll()
+	return logs, err
 }
 
-// Input: [2021/12/13 20:41:00.755 +08:00] [INFO] [store.go:68] ["new store"] [path=unistore:///tmp/tidb]
-// Output: "[", "2021/12/13 20:41:00.755 +08:00", "]", "[", "INFO","]", "[", "new store", "]", "[", "path", "=", "unistore:///tmp/tidb", "]"
-func parseLine(line string) []string {
-	s := scanner.Scanner{}
-	s.Init(strings.NewReader(line))
+// ParseFromReaderWithPosition is like ParseFromReader, but it fills the
+// Position of every entry, the source is the name of lr, eg. the file name.
+func ParseFromReaderWithPosition(lr io.Reader, source string) ([]*LogEntry, error) {
+	logs, _, err := NewStreamParser(lr).WithSource(source).ReadAll()
+	return logs, err
+}
 
-	s.Error = func(s *scanner.Scanner, msg string) {}
-	s.IsIdentRune = func(ch rune, i int) bool {
-		r := !strings.ContainsRune(`[=]"`, ch) && ch != scanner.EOF
-		return r
-	}
+// ParseFromReaderLenient is like ParseFromReader, but it skips malformed
+// lines and returns them as parse errors together with the valid entries.
+// The returned error is only non-nil if reading from lr fails.
+func ParseFromReaderLenient(lr io.Reader) ([]*LogEntry, []*ParseError, error) {
+	return NewStreamParser(lr).Lenient().ReadAll()
+}
 
-	xs := []string{}
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		xs = append(xs, s.TokenText())
-	}
-	return xs
+// parseEntry parses one line, it returns (nil, nil) for a blank line.
+func parseEntry(line string) (*LogEntry, *ParseError) {
+	return (&lexer{}).parseEntry(line, defaultTimeParser())
 }
 
-func unquote(s string) (string, error) {
-	if len(s) == 0 || s[0] != '"' {
-		return s, nil
+// parseEntry parses one line with the lexer, it returns (nil, nil) for
+// a blank line.
+func (l *lexer) parseEntry(line string, times *timeParser) (*LogEntry, *ParseError) {
+	if isLegacyLine(line) {
+		return parseLegacyEntry(line, times)
+	}
+	if isKlogLine(line) {
+		return parseKlogEntry(line, times)
+	}
+	tokens, lerr := l.lex(line)
+	if lerr != nil {
+		return nil, lerr
+	}
+	if len(tokens) == 0 {
+		return nil, nil
 	}
-	return strconv.Unquote(s)
+	p := Parser{tokens: tokens, eol: len(line), times: times, partial: l.partial}
+	log, err := p.Parse()
+	if err != nil {
+		return nil, err.(*ParseError)
+	}
+	return log, nil
+}
+
+// parseTruncated parses the beginning of a truncated line, the fields after
+// the header are kept as far as they go.
+func (l *lexer) parseTruncated(line string, times *timeParser) (*LogEntry, *ParseError) {
+	l.partial = true
+	defer func() { l.partial = false }()
+	log, err := l.parseEntry(line, times)
+	if log != nil {
+		log.Truncated = true
+	}
+	return log, err
 }
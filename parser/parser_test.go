@@ -15,6 +15,7 @@
 package parser
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -141,3 +142,37 @@ func TestParseFromString(t *testing.T) {
 		assert.Equal(t, l, log)
 	}
 }
+
+func TestParseFromStringLenient(t *testing.T) {
+	str := `[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:336] ["disable Prometheus push client"]
+[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:336]
+[2021/12/13 20:41:00.755 +08:00] [NOTICE] [main.go:336] ["unknown level"]
+[2021/12/13 20:41:00.756 +08:00] [INFO] [main.go:337] ["new store"] [path=unistore:///tmp/tidb]
+`
+	_, err := ParseFromString(str)
+	perr, ok := err.(*ParseError)
+	assert.True(t, ok)
+	assert.Equal(t, 2, perr.Line)
+
+	logs, errs, err := ParseFromReaderLenient(strings.NewReader(str))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(logs))
+	assert.Equal(t, "disable Prometheus push client", logs[0].Message)
+	assert.Equal(t, "new store", logs[1].Message)
+	assert.Equal(t, 2, len(errs))
+
+	assert.Equal(t, 2, errs[0].Line)
+	assert.Equal(t, 54, errs[0].Column)
+	assert.Equal(t, int64(89+53), errs[0].Offset)
+	assert.Equal(t, "", errs[0].Token)
+	assert.Equal(t, `[2021/12/13 20:41:00.755 +08:00] [INFO] [main.go:336]`, errs[0].Raw)
+	_, ok = errs[0].Err.(*UnexpectedEOLError)
+	assert.True(t, ok)
+
+	assert.Equal(t, 3, errs[1].Line)
+	assert.Equal(t, 35, errs[1].Column)
+	assert.Equal(t, "NOTICE", errs[1].Token)
+	assert.Equal(t, int64(89+54+34), errs[1].Offset)
+	_, ok = errs[1].Err.(*UnexpectedTokenError)
+	assert.True(t, ok)
+}
@@ -17,28 +17,146 @@ package parser
 import (
 	"bufio"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/pingcap/errors"
 )
 
+// DefaultMaxContinuationSize is the default number of bytes of continuation
+// lines kept for one LogEntry in multi-line mode.
+const DefaultMaxContinuationSize = 1024 * 1024
+
+// DefaultMaxLineSize is the default number of bytes kept for one line, the
+// rest of a longer line is discarded and its LogEntry is marked Truncated.
+const DefaultMaxLineSize = 1024 * 1024
+
+// withoutTimeHeader is the fake datetime header prepended to lines
+// in the WithoutTime mode.
+const withoutTimeHeader = "[2006/01/02 15:04:05.000 -07:00] "
+
 // StreamParser is a parser implementation which parses bytes from
 // io.Reader into individual *LogEntry. Users can parse large log files
 // on demand without having to read them all into memory at once.
 type StreamParser struct {
-	scanner     *bufio.Scanner
-	Line        int
+	reader *bufio.Reader
+	err    error // the error of reading from reader
+	Line   int
+	// Source is the name of the input being parsed, eg. the file name.
+	Source      string
 	withoutTime bool
+	format      LogFormat
+	times       *timeParser
+
+	// Errors collects the malformed lines skipped in lenient mode.
+	Errors  []*ParseError
+	lenient bool
+
+	// multi-line mode
+	multiline       bool
+	maxContinuation int
+	pending         *rawLine
+
+	maxLineSize int
+	lineBuf     []byte
+
+	// container mode, the pod and container of podSource are cached
+	containers     bool
+	podSource      string
+	pod, container string
+
+	lexer     lexer
+	offset    int64 // byte offset of the line being parsed
+	read      int   // number of lines read from reader
+	consumed  int64 // number of bytes read from reader
+	lineStart int64 // byte offset of the last line read from reader
+
+	// the inputs after the current one, see OpenLogFiles
+	sources   func() (io.ReadCloser, string, error)
+	closer    io.Closer
+	positions bool
+
+	// errReported tells err has been returned by Next
+	errReported bool
+	// idle tells the last scan found no line since a followed file is not
+	// written for a while, an entry waiting for its continuation is complete
+	idle bool
+}
+
+// rawLine is one line read from the input.
+type rawLine struct {
+	text      string
+	number    int
+	offset    int64
+	truncated bool
+	container *ContainerMeta
+	// parsed is the entry of the line parsed ahead, see readContinuation
+	parsed *LogEntry
 }
 
 // NewStreamParser creates new *StreamParser associated with the io.Reader.
 func NewStreamParser(reader io.Reader) *StreamParser {
-	scanner := bufio.NewScanner(reader)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-	return &StreamParser{
-		scanner: scanner,
-		Line:    0,
+	sp := &StreamParser{
+		Line:        0,
+		format:      LogFormatAuto,
+		times:       defaultTimeParser(),
+		maxLineSize: DefaultMaxLineSize,
+	}
+	sp.reset(reader, "")
+	return sp
+}
+
+// reset makes the parser continue with a new input.
+func (sp *StreamParser) reset(reader io.Reader, source string) {
+	sp.reader = bufio.NewReaderSize(reader, 64*1024)
+	sp.err = nil
+	sp.errReported = false
+	sp.Source = source
+	sp.Line = 0
+	sp.read = 0
+	sp.consumed = 0
+	sp.lineStart = 0
+	// the layout of datetime is detected for every input
+	sp.times.detected = -1
+}
+
+// nextSource switches to the next input, it returns false if there is none.
+func (sp *StreamParser) nextSource() (bool, error) {
+	if sp.sources == nil {
+		return false, nil
+	}
+	if err := sp.closeSource(); err != nil {
+		return false, err
+	}
+	reader, source, err := sp.sources()
+	if err == io.EOF {
+		sp.sources = nil
+		// the last input is closed
+		sp.reader.Reset(strings.NewReader(""))
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Annotatef(err, "open %s", source)
+	}
+	sp.reset(reader, source)
+	sp.closer = reader
+	return true, nil
+}
+
+func (sp *StreamParser) closeSource() error {
+	if sp.closer == nil {
+		return nil
 	}
+	err := sp.closer.Close()
+	sp.closer = nil
+	return err
+}
+
+// Close closes the opened input files, it's only needed for the parsers
+// created by OpenLogFiles and OpenLogSet.
+func (sp *StreamParser) Close() error {
+	sp.sources = nil
+	return sp.closeSource()
 }
 
 func (sp *StreamParser) WithoutTime() *StreamParser {
@@ -46,27 +164,377 @@ func (sp *StreamParser) WithoutTime() *StreamParser {
 	return sp
 }
 
+// WithFormat sets the format of the input, by default the format of every
+// line is detected automatically.
+func (sp *StreamParser) WithFormat(format LogFormat) *StreamParser {
+	sp.format = format
+	return sp
+}
+
+// WithTimeLayouts registers additional layouts of the datetime in the log
+// header, they're tried before DefaultTimeLayouts.
+func (sp *StreamParser) WithTimeLayouts(layouts ...string) *StreamParser {
+	layouts = append(append([]string{}, layouts...), sp.times.layouts...)
+	reference := sp.times.reference
+	sp.times = newTimeParser(layouts, sp.times.location)
+	sp.times.reference = reference
+	return sp
+}
+
+// WithLocation sets the location of the datetime without timezone,
+// time.Local is used by default.
+func (sp *StreamParser) WithLocation(location *time.Location) *StreamParser {
+	reference := sp.times.reference
+	sp.times = newTimeParser(sp.times.layouts, location)
+	sp.times.reference = reference
+	return sp
+}
+
+// WithReferenceTime sets the time the year of the datetime without year,
+// eg. of klog, is inferred from, the current time is used by default. It's
+// the latest year in which the datetime is no later than a day after t,
+// so t should be a time after the logs are written, eg. the modification
+// time of the file.
+func (sp *StreamParser) WithReferenceTime(t time.Time) *StreamParser {
+	sp.times.reference = t
+	return sp
+}
+
+// Lenient makes the parser skip malformed lines instead of returning
+// errors for them, the skipped lines are collected in sp.Errors.
+func (sp *StreamParser) Lenient() *StreamParser {
+	sp.lenient = true
+	return sp
+}
+
+// WithPosition makes the parser fill the Position of every LogEntry.
+func (sp *StreamParser) WithPosition() *StreamParser {
+	sp.positions = true
+	return sp
+}
+
+// WithSource sets the name of the input, eg. the file name, and makes the
+// parser fill the Position of every LogEntry.
+func (sp *StreamParser) WithSource(source string) *StreamParser {
+	sp.Source = source
+	return sp.WithPosition()
+}
+
+// WithMaxLineSize sets the number of bytes kept for one line, the rest of
+// a longer line is discarded. The beginning of the line is parsed as far as
+// it goes and the LogEntry is marked Truncated, so an over-long line doesn't
+// stop the parsing. A non-positive size means DefaultMaxLineSize.
+func (sp *StreamParser) WithMaxLineSize(size int) *StreamParser {
+	if size <= 0 {
+		size = DefaultMaxLineSize
+	}
+	sp.maxLineSize = size
+	return sp
+}
+
+// WithMultiline makes the parser attach lines which don't start with a log
+// header (eg. panics, stack traces and goroutine dumps) to the preceding
+// LogEntry as its Continuation. At most maxSize bytes of continuation lines
+// are kept for one entry, the rest are discarded and the entry is marked
+// Truncated. A non-positive maxSize means DefaultMaxContinuationSize.
+func (sp *StreamParser) WithMultiline(maxSize int) *StreamParser {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxContinuationSize
+	}
+	sp.multiline = true
+	sp.maxContinuation = maxSize
+	return sp
+}
+
 // Next reads and parses one LogEntry from bufio.Reader on demand.
 // This function will return (nil, nil) if the underlying io.Reader returns
-// io.EOF in the standard case.
+// io.EOF in the standard case. A malformed line is reported as a
+// *ParseError, unless the parser is lenient. An error of reading the input,
+// eg. a truncated gzip file, is returned once, and then the parser goes on
+// with the next input if any.
 func (sp *StreamParser) Next() (*LogEntry, error) {
-	for sp.scanner.Scan() {
-		sp.Line++
-		line := sp.scanner.Text()
-		if sp.withoutTime {
-			line = "[2006/01/02 15:04:05.000 -07:00] " + line
+	for {
+		line := sp.readLine()
+		if line == nil && sp.idle {
+			// a followed file is not written for a while
+			sp.idle = false
+			continue
 		}
-		tokens := parseLine(line)
-		if len(tokens) == 0 {
+		if line == nil {
+			if sp.err != nil && !sp.errReported {
+				break
+			}
+			ok, err := sp.nextSource()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
 			continue
 		}
-		p := Parser{tokens: tokens}
-		log, err := p.Parse()
+		log, err := line.parsed, (*ParseError)(nil)
+		if log == nil {
+			log, err = sp.parse(line)
+		}
+		if err != nil {
+			if sp.lenient {
+				sp.Errors = append(sp.Errors, err)
+				continue
+			}
+			return nil, err
+		}
+		if log == nil {
+			continue
+		}
+		if sp.multiline {
+			sp.readContinuation(log)
+		}
+		log.Container = line.container
+		if sp.positions {
+			log.Position = &LogPosition{
+				Source: sp.Source,
+				Line:   line.number,
+				Offset: line.offset,
+				Raw:    line.text,
+			}
+		}
+		return log, nil
+	}
+	sp.Line = sp.read + 1
+	if sp.err == nil || sp.errReported {
+		return nil, nil
+	}
+	sp.errReported = true
+	if sp.Source != "" {
+		return nil, errors.Annotatef(sp.err, "%s at line %d", sp.Source, sp.Line)
+	}
+	return nil, errors.Annotatef(sp.err, "at line %d", sp.Line)
+}
+
+// ReadAll parses all the remaining entries. In strict mode it stops at the
+// first malformed line, in lenient mode it returns the valid entries and the
+// skipped lines.
+func (sp *StreamParser) ReadAll() ([]*LogEntry, []*ParseError, error) {
+	logs := []*LogEntry{}
+	for {
+		log, err := sp.Next()
+		if err != nil {
+			if sp.lenient {
+				return logs, sp.Errors, err
+			}
+			return nil, nil, err
+		}
+		if log == nil {
+			return logs, sp.Errors, nil
+		}
+		logs = append(logs, log)
+	}
+}
+
+func (sp *StreamParser) parse(line *rawLine) (*LogEntry, *ParseError) {
+	if sp.format == LogFormatJSON || (sp.format == LogFormatAuto && isJSONLine(line.text)) {
+		log, err := parseJSONEntry(line.text, sp.times, line.truncated)
 		if err != nil {
-			return nil, errors.Annotatef(err, "at line %d", sp.Line)
+			return nil, sp.locate(line, err)
 		}
 		return log, nil
 	}
-	sp.Line++
-	return nil, errors.Annotatef(sp.scanner.Err(), "at line %d", sp.Line)
+
+	text := line.text
+	if sp.withoutTime {
+		text = withoutTimeHeader + text
+	}
+	var log *LogEntry
+	var err *ParseError
+	if line.truncated {
+		log, err = sp.lexer.parseTruncated(text, sp.times)
+	} else {
+		log, err = sp.lexer.parseEntry(text, sp.times)
+	}
+	if err != nil {
+		if sp.withoutTime {
+			err.Column -= len(withoutTimeHeader)
+			if err.Column < 1 {
+				err.Column = 1
+			}
+		}
+		return nil, sp.locate(line, err)
+	}
+	return log, nil
+}
+
+// locate fills the position of the line into err.
+func (sp *StreamParser) locate(line *rawLine, err *ParseError) *ParseError {
+	err.Source = sp.Source
+	err.Line = line.number
+	err.Offset = line.offset + int64(err.Column-1)
+	err.Raw = line.text
+	err.Truncated = line.truncated
+	return err
+}
+
+// readLine returns the next line to be parsed and sets sp.Line to its number,
+// it returns nil if there are no more lines.
+func (sp *StreamParser) readLine() *rawLine {
+	if sp.pending != nil {
+		line := sp.pending
+		sp.pending = nil
+		sp.Line = line.number
+		sp.offset = line.offset
+		return line
+	}
+	line := sp.scan()
+	if line == nil {
+		return nil
+	}
+	sp.Line = line.number
+	sp.offset = line.offset
+	return line
+}
+
+func (sp *StreamParser) scan() *rawLine {
+	line := sp.scanLine()
+	if line == nil || !sp.containers {
+		return line
+	}
+	return sp.unwrap(line)
+}
+
+// scanLine reads the next physical line.
+func (sp *StreamParser) scanLine() *rawLine {
+	sp.idle = false
+	if sp.err != nil {
+		return nil
+	}
+	text, truncated, err := sp.readRaw()
+	if err != nil {
+		if err == errIdle {
+			sp.idle = true
+		} else if err != io.EOF {
+			sp.err = err
+		}
+		return nil
+	}
+	sp.read++
+	return &rawLine{
+		text:      text,
+		number:    sp.read,
+		offset:    sp.lineStart,
+		truncated: truncated,
+	}
+}
+
+// readRaw reads one line without the line ending like bufio.ScanLines, at
+// most sp.maxLineSize bytes of it are kept. It returns io.EOF if there are
+// no more lines.
+func (sp *StreamParser) readRaw() (string, bool, error) {
+	sp.lineBuf = sp.lineBuf[:0]
+	size := 0
+	// the last two bytes of the line, to drop the line ending
+	var prev, last byte
+	for {
+		data, err := sp.reader.ReadSlice('\n')
+		sp.consumed += int64(len(data))
+		size += len(data)
+		switch {
+		case len(data) >= 2:
+			prev, last = data[len(data)-2], data[len(data)-1]
+		case len(data) == 1:
+			prev, last = last, data[0]
+		}
+		if n := sp.maxLineSize - len(sp.lineBuf); n > 0 {
+			if len(data) > n {
+				data = data[:n]
+			}
+			sp.lineBuf = append(sp.lineBuf, data...)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF && size > 0 {
+			err = nil
+		}
+		if err == errIdle && size > 0 {
+			// wait for the rest of the line
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		break
+	}
+	// counted backwards as the reader may switch to a new file in follow mode
+	sp.lineStart = sp.consumed - int64(size)
+	if last == '\n' {
+		size--
+		if size > 0 && prev == '\r' {
+			size--
+		}
+	}
+	if size < len(sp.lineBuf) {
+		sp.lineBuf = sp.lineBuf[:size]
+	}
+	return string(sp.lineBuf), size > sp.maxLineSize, nil
+}
+
+// readContinuation consumes the lines following a log header until the
+// next header and attaches them to the log. A line looking like a header
+// but failing to parse, eg. {"a":1} in a panic value, is a continuation.
+func (sp *StreamParser) readContinuation(log *LogEntry) {
+	size := 0
+	for line := sp.scan(); line != nil; line = sp.scan() {
+		if sp.isEntryStart(line.text) {
+			if next, err := sp.parse(line); err == nil {
+				line.parsed = next
+				sp.pending = line
+				break
+			}
+		}
+		if line.truncated {
+			log.Truncated = true
+		}
+		if size+len(line.text) > sp.maxContinuation {
+			// the blank lines are trimmed anyway
+			if strings.TrimSpace(line.text) != "" {
+				log.Truncated = true
+			}
+			continue
+		}
+		size += len(line.text)
+		log.Continuation = append(log.Continuation, line.text)
+	}
+	// blank lines between two entries don't belong to the first one
+	for n := len(log.Continuation); n > 0 && strings.TrimSpace(log.Continuation[n-1]) == ""; n-- {
+		log.Continuation = log.Continuation[:n-1]
+	}
+	if len(log.Continuation) == 0 {
+		log.Continuation = nil
+	}
+}
+
+// parsesHeader tells if the line looking like a header is parsed as one,
+// the others are continuations, see readContinuation.
+func (sp *StreamParser) parsesHeader(text string, truncated bool) bool {
+	_, err := sp.parse(&rawLine{text: text, truncated: truncated})
+	return err == nil
+}
+
+// isEntryStart checks if the line begins a new LogEntry rather than continues
+// the previous one.
+func (sp *StreamParser) isEntryStart(line string) bool {
+	if sp.format != LogFormatText && isJSONLine(line) {
+		return true
+	}
+	if sp.format != LogFormatJSON && (isLegacyLine(line) || isKlogLine(line)) {
+		return true
+	}
+	line = strings.TrimLeft(line, " \t")
+	if len(line) == 0 || line[0] != '[' {
+		return false
+	}
+	if sp.withoutTime {
+		return true
+	}
+	return len(line) > 1 && line[1] >= '0' && line[1] <= '9'
 }
@@ -59,3 +59,161 @@ func TestStream(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Nil(t, l)
 }
+
+func TestStreamMultiline(t *testing.T) {
+	logtxt := `[2021/12/16 17:03:48.696 +08:00] [INFO] [trackerRecorder.go:28] ["Mem Profile Tracker started"]
+[2021/12/16 17:03:49.012 +08:00] [FATAL] [session.go:2112] ["panic in the recoverable goroutine"]
+panic: runtime error: index out of range [3] with length 3
+
+goroutine 1 [running]:
+github.com/pingcap/tidb/session.(*session).Execute(0xc000a2c000)
+	/home/jenkins/agent/workspace/tidb/session/session.go:2112 +0x1a5
+
+[2021/12/16 17:03:50.000 +08:00] [INFO] [server.go:100] ["server is running"]
+`
+	s := NewStreamParser(strings.NewReader(logtxt)).WithMultiline(0)
+
+	l, err := s.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "Mem Profile Tracker started", l.Message)
+	assert.Nil(t, l.Continuation)
+	assert.Equal(t, 1, s.Line)
+
+	l, err = s.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "panic in the recoverable goroutine", l.Message)
+	assert.Equal(t, []string{
+		"panic: runtime error: index out of range [3] with length 3",
+		"",
+		"goroutine 1 [running]:",
+		"github.com/pingcap/tidb/session.(*session).Execute(0xc000a2c000)",
+		"\t/home/jenkins/agent/workspace/tidb/session/session.go:2112 +0x1a5",
+	}, l.Continuation)
+	assert.False(t, l.Truncated)
+	assert.Equal(t, 2, s.Line)
+
+	l, err = s.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "server is running", l.Message)
+	assert.Equal(t, 9, s.Line)
+
+	l, err = s.Next()
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+
+	// the continuation exceeding the max size is discarded
+	s = NewStreamParser(strings.NewReader(logtxt)).WithMultiline(80)
+	_, err = s.Next()
+	assert.Nil(t, err)
+	l, err = s.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"panic: runtime error: index out of range [3] with length 3",
+		"",
+		"goroutine 1 [running]:",
+	}, l.Continuation)
+	assert.True(t, l.Truncated)
+
+	// the lines looking like headers but not parsed as them are continuations
+	logtxt = `[2021/12/16 17:03:49.012 +08:00] [FATAL] [session.go:2112] ["panic in the recoverable goroutine"]
+panic: {"a":1}
+{"a":1}
+[1] x
+	/home/jenkins/agent/workspace/tidb/session/session.go:2112 +0x1a5
+[2021/12/16 17:03:50.000 +08:00] [INFO] [server.go:100] ["server is running"]
+`
+	logs, errs, err := NewStreamParser(strings.NewReader(logtxt)).WithMultiline(0).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, 2, len(logs))
+	assert.Equal(t, []string{
+		`panic: {"a":1}`,
+		`{"a":1}`,
+		"[1] x",
+		"\t/home/jenkins/agent/workspace/tidb/session/session.go:2112 +0x1a5",
+	}, logs[0].Continuation)
+	assert.Equal(t, "server is running", logs[1].Message)
+}
+
+func TestStreamPosition(t *testing.T) {
+	logtxt := "[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [1]\n\n[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [2]\npanic: x\n"
+	logs, err := ParseFromReaderWithPosition(strings.NewReader(strings.TrimSuffix(logtxt, "panic: x\n")), "tidb.log")
+	assert.Nil(t, err)
+	assert.Equal(t, &LogPosition{Source: "tidb.log", Line: 1, Offset: 0, Raw: "[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [1]"}, logs[0].Position)
+	assert.Equal(t, "tidb.log:3", logs[1].Position.String())
+	assert.Equal(t, int64(54), logs[1].Position.Offset)
+
+	logs, _, err = NewStreamParser(strings.NewReader(logtxt)).WithPosition().WithMultiline(0).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"panic: x"}, logs[1].Continuation)
+	assert.Equal(t, &LogPosition{Line: 3, Offset: 54, Raw: "[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] [2]"}, logs[1].Position)
+	assert.Equal(t, "line 3", logs[1].Position.String())
+
+	logs, _, err = NewStreamParser(strings.NewReader(logtxt)).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Nil(t, logs[0].Position)
+}
+
+func TestStreamMaxLineSize(t *testing.T) {
+	header := "[2021/12/13 20:41:00.755 +08:00] [INFO] [a.go:1] "
+	huge := strings.Repeat("x", 2*DefaultMaxLineSize)
+	logtxt := strings.Join([]string{
+		header + `[short] [k=v]`,
+		header + `[long] [k=v] [sql="select ` + strings.Repeat("1", 100) + `"] [end=1]`,
+		header[:20] + strings.Repeat("x", 200),
+		`{"level":"WARN","time":"2021/12/13 20:41:00.755 +08:00","message":"json","k":"v","sql":"` + strings.Repeat("2", 100) + `"}`,
+		header + `[exact]` + strings.Repeat(" ", 120-len(header)-len("[exact]")) + "\r",
+		header + `[huge] [k=` + huge + `]`,
+		header + `[last]`,
+	}, "\n")
+	sp := NewStreamParser(strings.NewReader(logtxt)).WithMaxLineSize(120)
+
+	l, err := sp.Next()
+	assert.Nil(t, err)
+	assert.False(t, l.Truncated)
+
+	l, err = sp.Next()
+	assert.Nil(t, err)
+	assert.True(t, l.Truncated)
+	assert.Equal(t, "long", l.Message)
+	assert.Equal(t, []LogField{{"k", "v"}, {"sql", "select " + strings.Repeat("1", 120-len(header)-len(`[long] [k=v] [sql="select `))}}, l.Fields)
+
+	_, err = sp.Next()
+	perr := err.(*ParseError)
+	assert.True(t, perr.Truncated)
+	assert.Equal(t, "", perr.Source)
+	assert.Equal(t, 3, perr.Line)
+	assert.Equal(t, 120, len(perr.Raw))
+
+	l, err = sp.Next()
+	assert.Nil(t, err)
+	assert.True(t, l.Truncated)
+	assert.Equal(t, LogLevelWarn, l.Header.Level)
+	assert.Equal(t, "json", l.Message)
+	assert.Equal(t, []LogField{{"k", "v"}}, l.Fields)
+
+	l, err = sp.Next()
+	assert.Nil(t, err)
+	assert.False(t, l.Truncated)
+	assert.Equal(t, "exact", l.Message)
+
+	l, err = sp.Next()
+	assert.Nil(t, err)
+	assert.True(t, l.Truncated)
+	assert.Equal(t, []LogField{{"k", strings.Repeat("x", 120-len(header)-len("[huge] [k="))}}, l.Fields)
+
+	l, err = sp.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "last", l.Message)
+	assert.Equal(t, 7, sp.Line)
+	assert.Equal(t, int64(len(logtxt)-len(header)-len("[last]")), sp.offset)
+
+	l, err = sp.Next()
+	assert.Nil(t, err)
+	assert.Nil(t, l)
+
+	// the default is enough for the huge line
+	logs, err := ParseFromString(header + `[huge] [k=` + huge + `]`)
+	assert.Nil(t, err)
+	assert.True(t, logs[0].Truncated)
+}
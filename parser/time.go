@@ -0,0 +1,114 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pingcap/errors"
+)
+
+// DefaultTimeLayouts are the datetime layouts of the log header accepted by
+// default, which covers the historical PingCAP components and the common
+// layouts of the tools reprocessing logs. Fractional seconds of any precision
+// are accepted by every layout. The layouts without timezone are parsed in
+// the location of the parser, time.Local by default, and a timezone
+// abbreviation is only accepted if it's UTC or known by the location.
+var DefaultTimeLayouts = []string{
+	TiDBTimeFormat,
+	"2006/01/02 15:04:05 -07:00",
+	"2006/01/02 15:04:05 -0700",
+	"2006/01/02 15:04:05 MST",
+	"2006/01/02 15:04:05",
+	time.RFC3339,
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+}
+
+// timeParser parses the datetime of log headers. The layout of the first
+// datetime parsed is tried first for the following ones, since the lines
+// of one input are almost always in the same layout.
+type timeParser struct {
+	layouts  []string
+	location *time.Location
+	detected int
+	// reference is the time the year of the datetime without year is
+	// inferred from, the current time if it's zero.
+	reference time.Time
+}
+
+func newTimeParser(layouts []string, location *time.Location) *timeParser {
+	return &timeParser{
+		layouts:  layouts,
+		location: location,
+		detected: -1,
+	}
+}
+
+// now returns the reference time in the location of the parser.
+func (tp *timeParser) now() time.Time {
+	if tp.reference.IsZero() {
+		return time.Now().In(tp.location)
+	}
+	return tp.reference.In(tp.location)
+}
+
+func defaultTimeParser() *timeParser {
+	return newTimeParser(DefaultTimeLayouts, time.Local)
+}
+
+// parseLayout parses s in the layout. A timezone abbreviation is only
+// accepted if it's UTC or one of the location of the parser, since the
+// others are taken as UTC by time.Parse, eg. CST of China Standard Time.
+func (tp *timeParser) parseLayout(layout, s string) (time.Time, error) {
+	t, err := time.ParseInLocation(layout, s, tp.location)
+	if err != nil || !strings.Contains(layout, "MST") {
+		return t, err
+	}
+	if loc := t.Location(); loc != tp.location && loc != time.UTC {
+		name, _ := t.Zone()
+		return time.Time{}, errors.Errorf("unknown timezone abbreviation %s in %s", name, tp.location)
+	}
+	return t, nil
+}
+
+func (tp *timeParser) parse(s string) (time.Time, error) {
+	if tp.detected >= 0 {
+		if t, err := tp.parseLayout(tp.layouts[tp.detected], s); err == nil {
+			return t, nil
+		}
+	}
+	var firstErr error
+	for i, layout := range tp.layouts {
+		if i == tp.detected {
+			continue
+		}
+		t, err := tp.parseLayout(layout, s)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if tp.detected < 0 {
+			tp.detected = i
+		}
+		return t, nil
+	}
+	return time.Time{}, firstErr
+}
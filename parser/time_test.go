@@ -0,0 +1,196 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeLayouts(t *testing.T) {
+	cst := time.FixedZone("CST", 3600*8)
+	tests := map[string]time.Time{
+		"2021/12/13 20:41:00.755 +08:00":    time.Date(2021, 12, 13, 20, 41, 0, 755000000, cst),
+		"2021/12/13 20:41:00.755123 +08:00": time.Date(2021, 12, 13, 20, 41, 0, 755123000, cst),
+		"2021/12/13 20:41:00 +08:00":        time.Date(2021, 12, 13, 20, 41, 0, 0, cst),
+		"2021/12/13 20:41:00.755 +0800":     time.Date(2021, 12, 13, 20, 41, 0, 755000000, cst),
+		"2021/12/13 20:41:00.755":           time.Date(2021, 12, 13, 20, 41, 0, 755000000, time.UTC),
+		"2021-12-13T20:41:00.755+08:00":     time.Date(2021, 12, 13, 20, 41, 0, 755000000, cst),
+		"2021-12-13T12:41:00.755123456Z":    time.Date(2021, 12, 13, 20, 41, 0, 755123456, cst),
+		"2021-12-13 20:41:00.755 +08:00":    time.Date(2021, 12, 13, 20, 41, 0, 755000000, cst),
+		"2021-12-13 20:41:00.755":           time.Date(2021, 12, 13, 20, 41, 0, 755000000, time.UTC),
+		"2021-12-13T20:41:00.755":           time.Date(2021, 12, 13, 20, 41, 0, 755000000, time.UTC),
+	}
+	for s, expected := range tests {
+		tp := newTimeParser(DefaultTimeLayouts, time.UTC)
+		dt, err := tp.parse(s)
+		assert.Nil(t, err, s)
+		assert.True(t, expected.Equal(dt), s)
+	}
+
+	// the abbreviation is resolved by the location rather than taken as UTC
+	tp := newTimeParser(DefaultTimeLayouts, time.UTC)
+	_, err := tp.parse("2019/03/11 14:33:58 CST")
+	assert.NotNil(t, err)
+	dt, err := tp.parse("2019/03/11 14:33:58 UTC")
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2019, 3, 11, 14, 33, 58, 0, time.UTC).Equal(dt))
+	tp = newTimeParser(DefaultTimeLayouts, cst)
+	dt, err = tp.parse("2019/03/11 14:33:58 CST")
+	assert.Nil(t, err)
+	assert.True(t, time.Date(2019, 3, 11, 14, 33, 58, 0, cst).Equal(dt))
+
+	tp = newTimeParser(DefaultTimeLayouts, time.UTC)
+	_, err = tp.parse("Dec 13 20:41:00")
+	assert.NotNil(t, err)
+	assert.Equal(t, -1, tp.detected)
+
+	// the layout of the first datetime is detected
+	_, err = tp.parse("2021-12-13T20:41:00.755+08:00")
+	assert.Nil(t, err)
+	assert.Equal(t, time.RFC3339, tp.layouts[tp.detected])
+	_, err = tp.parse("2021/12/13 20:41:00.755 +08:00")
+	assert.Nil(t, err)
+	assert.Equal(t, time.RFC3339, tp.layouts[tp.detected])
+}
+
+func TestStreamTimeLayouts(t *testing.T) {
+	logtxt := `[Dec 13 20:41:00.755] [INFO] [main.go:336] ["custom layout"]
+[2021-12-13T20:41:00.755+08:00] [INFO] [main.go:336] ["rfc3339"]
+[2021/12/13 20:41:00.755] [INFO] [main.go:336] ["no timezone"]
+`
+	_, errs, err := NewStreamParser(strings.NewReader(logtxt)).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, 1, errs[0].Line)
+
+	cst := time.FixedZone("CST", 3600*8)
+	logs, errs, err := NewStreamParser(strings.NewReader(logtxt)).WithTimeLayouts("Jan 02 15:04:05").WithLocation(cst).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(errs))
+	assert.Equal(t, 3, len(logs))
+	assert.True(t, time.Date(0, 12, 13, 20, 41, 0, 755000000, cst).Equal(logs[0].Header.DateTime))
+	assert.True(t, time.Date(2021, 12, 13, 20, 41, 0, 755000000, cst).Equal(logs[1].Header.DateTime))
+	assert.True(t, time.Date(2021, 12, 13, 20, 41, 0, 755000000, cst).Equal(logs[2].Header.DateTime))
+}
+
+func TestLegacyHeader(t *testing.T) {
+	logtxt := `2019/03/11 14:33:58.123 server.go:166: [info] [con:1] new connection 127.0.0.1:53498
+2019/03/11 14:33:58.123 INFO mod.rs:26: Welcome to TiKV.
+2019/03/11 14:33:58.123 WARN mod.rs:26:
+[2019/03/11 14:33:58.123 +08:00] [warning] [util.go:59] ["Welcome to Placement Driver (PD)."]
+[2019/03/11 14:33:58.123 +08:00] [CRIT] [mod.rs:1] ["panic"]
+[2019/03/11 14:33:58.123 +08:00] [trace] [mod.rs:1] ["trace"]
+2019/03/11 14:33:58.123 [info] no file line
+2019/03/11 14:33:58.123 server.go:166: info no brackets
+`
+	logs, errs, err := NewStreamParser(strings.NewReader(logtxt)).WithLocation(time.UTC).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, []*LogEntry{{
+		Header: LogHeader{
+			DateTime: time.Date(2019, 3, 11, 14, 33, 58, 123000000, time.UTC),
+			Level:    LogLevelInfo,
+			File:     "server.go",
+			Line:     166,
+		},
+		Message: "[con:1] new connection 127.0.0.1:53498",
+		Fields:  []LogField{},
+	}, {
+		Header: LogHeader{
+			DateTime: time.Date(2019, 3, 11, 14, 33, 58, 123000000, time.UTC),
+			Level:    LogLevelInfo,
+			File:     "mod.rs",
+			Line:     26,
+		},
+		Message: "Welcome to TiKV.",
+		Fields:  []LogField{},
+	}, {
+		Header: LogHeader{
+			DateTime: time.Date(2019, 3, 11, 14, 33, 58, 123000000, time.UTC),
+			Level:    LogLevelWarn,
+			File:     "mod.rs",
+			Line:     26,
+		},
+		Message: "",
+		Fields:  []LogField{},
+	}}, logs[:3])
+	assert.Equal(t, LogLevelWarn, logs[3].Header.Level)
+	assert.Equal(t, LogLevelFatal, logs[4].Header.Level)
+	assert.Equal(t, LogLevelTrace, logs[5].Header.Level)
+	assert.Equal(t, 6, len(logs))
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, 25, errs[0].Column)
+	assert.Equal(t, "[info]", errs[0].Token)
+	assert.Equal(t, 40, errs[1].Column)
+	assert.Equal(t, "info", errs[1].Token)
+
+	// legacy lines are entries rather than continuations
+	s := NewStreamParser(strings.NewReader(logtxt)).WithMultiline(0)
+	l, err := s.Next()
+	assert.Nil(t, err)
+	assert.Nil(t, l.Continuation)
+}
+
+func TestKlogHeader(t *testing.T) {
+	logtxt := `I1213 20:41:00.755123       1 tidb_cluster_control.go:123] TidbCluster: [default/basic] updated successfully
+E1213 20:41:01.000000       1 tidb_cluster_control.go:130] "sync TidbCluster failed" err="pd is not ready" namespace="default" retry=3
+goroutine 1 [running]:
+W1213 20:41:02.000000       1 pd_member_manager.go:42] "half quoted
+I1213 20:41:03
+`
+	reference := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	logs, errs, err := NewStreamParser(strings.NewReader(logtxt)).WithReferenceTime(reference).WithLocation(time.UTC).WithMultiline(0).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(logs))
+	assert.Equal(t, &LogEntry{
+		Header: LogHeader{
+			DateTime: time.Date(2021, 12, 13, 20, 41, 0, 755123000, time.UTC),
+			Level:    LogLevelInfo,
+			File:     "tidb_cluster_control.go",
+			Line:     123,
+		},
+		Message: "TidbCluster: [default/basic] updated successfully",
+		Fields:  []LogField{},
+	}, logs[0])
+	assert.Equal(t, LogLevelError, logs[1].Header.Level)
+	assert.Equal(t, "sync TidbCluster failed", logs[1].Message)
+	assert.Equal(t, []LogField{{"err", "pd is not ready"}, {"namespace", "default"}, {"retry", "3"}}, logs[1].Fields)
+	assert.Equal(t, []string{"goroutine 1 [running]:"}, logs[1].Continuation)
+	assert.Equal(t, `"half quoted`, logs[2].Message)
+	// the malformed header is a continuation in multi-line mode
+	assert.Equal(t, []string{"I1213 20:41:03"}, logs[2].Continuation)
+	assert.Equal(t, 0, len(errs))
+	_, errs, err = NewStreamParser(strings.NewReader(logtxt)).WithReferenceTime(reference).Lenient().ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(errs))
+	assert.Equal(t, 5, errs[1].Line)
+
+	// the latest year not later than a day after the reference time
+	for datetime, expected := range map[string]time.Time{
+		"0228 23:00:00.000000": time.Date(2022, 2, 28, 23, 0, 0, 0, time.UTC),
+		"0301 12:00:00.000000": time.Date(2022, 3, 1, 12, 0, 0, 0, time.UTC),
+		"0302 12:00:00.000000": time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC),
+		"0229 12:00:00.000000": time.Date(2020, 2, 29, 12, 0, 0, 0, time.UTC),
+	} {
+		l, err := NewStreamParser(strings.NewReader("I" + datetime + "       1 main.go:1] m\n")).WithLocation(time.UTC).WithReferenceTime(reference).Next()
+		assert.Nil(t, err, datetime)
+		assert.Equal(t, expected, l.Header.DateTime, datetime)
+	}
+	_, err = NewStreamParser(strings.NewReader("I0230 12:00:00.000000       1 main.go:1] m\n")).WithReferenceTime(reference).Next()
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,361 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package slowlog parses the slow query log of TiDB, which looks like
+//
+//	# Time: 2021-12-13T20:41:00.755049432+08:00
+//	# Txn_start_ts: 429758679811096577
+//	# User@Host: root[root] @ 127.0.0.1 [127.0.0.1]
+//	# Conn_ID: 3
+//	# Query_time: 0.5012
+//	# Process_time: 0.1 Wait_time: 0.002 Request_count: 1
+//	# DB: test
+//	# Digest: 42a1c8aae6f133e934d4bf0147491709a8812ea05ff8819ec522780fe657b772
+//	# Plan: tidb_decode_plan('...')
+//	use test;
+//	select * from t where a = 1;
+//
+// Every record begins with "# Time:" and ends before the next one, the "#"
+// lines after the first line of the SQL statement are a part of it, eg. the
+// comments in the SQL.
+package slowlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/pingcap/errors"
+)
+
+const (
+	timePrefix = "# Time: "
+	// the layout of TiDB before v4.0
+	legacyTimeFormat = "2006-01-02-15:04:05.999999999 -0700"
+)
+
+// restOfLineKeys are the keys whose value is the rest of the line, since
+// the value may contain spaces.
+var restOfLineKeys = map[string]bool{
+	"User@Host":   true,
+	"Prev_stmt":   true,
+	"Plan":        true,
+	"Binary_plan": true,
+}
+
+// Record is one slow query.
+type Record struct {
+	Time       time.Time
+	TxnStartTS parser.TSO
+	User       string
+	Host       string
+	ConnID     uint64
+	QueryTime  time.Duration
+	DB         string
+	Digest     string
+	PlanDigest string
+	Plan       string
+	IsInternal bool
+	Succ       bool
+	MemMax     int64
+	PrevStmt   string
+	// SQL is the statement without the `use db;` line before it.
+	SQL string
+	// Fields are all the key/values of the "#" lines in order, including
+	// the ones converted to the fields above.
+	Fields []parser.LogField
+
+	// Position tells where the record begins.
+	Position parser.LogPosition
+}
+
+// Get returns the value of the first field with the name.
+func (r *Record) Get(name string) (string, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Parser parses the slow query log from an io.Reader record by record.
+type Parser struct {
+	reader *bufio.Reader
+	// Line is the number of the line last read.
+	Line int
+	// Source is the name of the input being parsed, eg. the file name.
+	Source   string
+	location *time.Location
+	// pending is the "# Time:" line of the next record read too early.
+	pending string
+	// err is the error of reading, it's returned once by Next
+	err         error
+	errReported bool
+}
+
+// RecordError is a malformed record, the parsing can go on with the next
+// record after it.
+type RecordError struct {
+	Source string
+	Line   int
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s at line %d: %s", e.Source, e.Line, e.Err)
+	}
+	return fmt.Sprintf("at line %d: %s", e.Line, e.Err)
+}
+
+// Cause returns the underlying error.
+func (e *RecordError) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the underlying error.
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// NewParser creates a *Parser reading from the reader.
+func NewParser(reader io.Reader) *Parser {
+	return &Parser{
+		reader:   bufio.NewReaderSize(reader, 64*1024),
+		location: time.Local,
+	}
+}
+
+// WithSource sets the name of the input, eg. the file name.
+func (p *Parser) WithSource(source string) *Parser {
+	p.Source = source
+	return p
+}
+
+// WithLocation sets the location of the time without timezone, time.Local
+// is used by default.
+func (p *Parser) WithLocation(location *time.Location) *Parser {
+	p.location = location
+	return p
+}
+
+// Next returns the next record, it returns (nil, nil) at the end of the
+// input. The lines before the first "# Time:" are skipped, and a record is
+// returned once the next one begins or the input ends, a record without
+// SQL is returned as is. A malformed record
+// is returned as a *RecordError, the parsing continues with the next record.
+// An error of reading the input is returned once, and then the input ends.
+func (p *Parser) Next() (*Record, error) {
+	var rec *Record
+	sql := []string{}
+	for {
+		line, ok := p.readLine()
+		if !ok {
+			if p.err != nil && !p.errReported {
+				p.errReported = true
+				if p.Source != "" {
+					return nil, errors.Annotatef(p.err, "read %s at line %d", p.Source, p.Line+1)
+				}
+				return nil, errors.Annotatef(p.err, "read at line %d", p.Line+1)
+			}
+			if rec != nil {
+				rec.SQL = joinSQL(sql)
+			}
+			return rec, nil
+		}
+		if strings.HasPrefix(line, timePrefix) {
+			if rec != nil {
+				// the end of the previous record
+				p.pending = line
+				p.Line--
+				rec.SQL = joinSQL(sql)
+				return rec, nil
+			}
+			t, err := p.parseTime(strings.TrimSpace(line[len(timePrefix):]))
+			if err != nil {
+				return nil, &RecordError{Source: p.Source, Line: p.Line, Err: err}
+			}
+			rec = &Record{
+				Time:     t,
+				Fields:   []parser.LogField{},
+				Position: parser.LogPosition{Source: p.Source, Line: p.Line, Raw: line},
+			}
+			continue
+		}
+		if rec == nil {
+			continue
+		}
+		if len(sql) == 0 && strings.HasPrefix(line, "#") {
+			if err := rec.parseFields(strings.TrimPrefix(line[1:], " ")); err != nil {
+				return nil, &RecordError{Source: p.Source, Line: p.Line, Err: err}
+			}
+			continue
+		}
+		if len(sql) == 0 && strings.HasPrefix(line, "use ") && strings.HasSuffix(line, ";") {
+			// the `use db;` is kept for the compatibility with MySQL
+			if rec.DB == "" {
+				rec.DB = strings.Trim(strings.TrimSuffix(line[len("use "):], ";"), " `")
+			}
+			continue
+		}
+		sql = append(sql, line)
+	}
+}
+
+// joinSQL joins the lines of the SQL statement without the blank lines at
+// the end.
+func joinSQL(sql []string) string {
+	for len(sql) > 0 && strings.TrimSpace(sql[len(sql)-1]) == "" {
+		sql = sql[:len(sql)-1]
+	}
+	return strings.Join(sql, "\n")
+}
+
+// ReadAll parses all the remaining records, it stops at the first error.
+func (p *Parser) ReadAll() ([]*Record, error) {
+	records := []*Record{}
+	for {
+		rec, err := p.Next()
+		if err != nil {
+			return nil, err
+		}
+		if rec == nil {
+			return records, nil
+		}
+		records = append(records, rec)
+	}
+}
+
+func (p *Parser) readLine() (string, bool) {
+	if p.pending != "" {
+		line := p.pending
+		p.pending = ""
+		p.Line++
+		return line, true
+	}
+	if p.err != nil {
+		return "", false
+	}
+	line, err := p.reader.ReadString('\n')
+	if err != nil {
+		if err != io.EOF {
+			p.err = err
+			return "", false
+		}
+		if line == "" {
+			return "", false
+		}
+	}
+	p.Line++
+	return strings.TrimRight(line, "\r\n"), true
+}
+
+func (p *Parser) parseTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.RFC3339Nano, s, p.location); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation(legacyTimeFormat, s, p.location)
+}
+
+// parseFields parses the "Key: value Key: value" of a "#" line.
+func (r *Record) parseFields(line string) error {
+	for line != "" {
+		sep := strings.Index(line, ": ")
+		if sep < 0 {
+			// eg. "# Plan: " with an empty value
+			if strings.HasSuffix(line, ":") && !strings.Contains(line, " ") {
+				return r.setField(line[:len(line)-1], "")
+			}
+			return errors.Errorf("expect 'Key: value', got '%s'", line)
+		}
+		key := line[:sep]
+		if strings.Contains(key, " ") {
+			return errors.Errorf("invalid key '%s'", key)
+		}
+		line = line[sep+2:]
+
+		var value string
+		switch {
+		case restOfLineKeys[key]:
+			value, line = line, ""
+		case strings.HasPrefix(line, "["):
+			// eg. "Backoff_types: [regionMiss tikvRPC]"
+			end := strings.Index(line, "]")
+			if end < 0 {
+				end = len(line) - 1
+			}
+			value, line = line[:end+1], line[end+1:]
+		default:
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			value, line = line[:end], line[end:]
+		}
+		line = strings.TrimLeft(line, " ")
+		if err := r.setField(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Record) setField(key, value string) error {
+	r.Fields = append(r.Fields, parser.LogField{Name: key, Value: value})
+	var err error
+	switch key {
+	case "Txn_start_ts":
+		r.TxnStartTS, err = parser.ParseTSO(value)
+	case "User@Host":
+		// root[root] @ 127.0.0.1 [127.0.0.1]
+		xs := strings.SplitN(value, " @ ", 2)
+		r.User = xs[0]
+		if i := strings.IndexByte(r.User, '['); i >= 0 {
+			r.User = r.User[:i]
+		}
+		if len(xs) == 2 {
+			if host := strings.Fields(xs[1]); len(host) > 0 {
+				r.Host = host[0]
+			}
+		}
+	case "Conn_ID":
+		r.ConnID, err = strconv.ParseUint(value, 10, 64)
+	case "Query_time":
+		var secs float64
+		secs, err = strconv.ParseFloat(value, 64)
+		r.QueryTime = time.Duration(secs * float64(time.Second))
+	case "DB":
+		r.DB = value
+	case "Digest":
+		r.Digest = value
+	case "Plan_digest":
+		r.PlanDigest = value
+	case "Plan":
+		r.Plan = value
+	case "Is_internal":
+		r.IsInternal, err = strconv.ParseBool(value)
+	case "Succ":
+		r.Succ, err = strconv.ParseBool(value)
+	case "Mem_max":
+		r.MemMax, err = strconv.ParseInt(value, 10, 64)
+	case "Prev_stmt":
+		r.PrevStmt = value
+	}
+	return errors.Annotatef(err, "field %s", key)
+}
@@ -0,0 +1,180 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const slowLog = `# Time: 2021-12-13T20:41:00.755049432+08:00
+# Txn_start_ts: 429758679811096577
+# User@Host: root[root] @ 127.0.0.1 [127.0.0.1]
+# Conn_ID: 3
+# Query_time: 0.5012
+# Parse_time: 0.000123
+# Process_time: 0.1 Wait_time: 0.002 Request_count: 1 Total_keys: 100
+# Backoff_types: [regionMiss tikvRPC] Backoff_total: 0.01
+# DB: test
+# Is_internal: false
+# Digest: 42a1c8aae6f133e934d4bf0147491709a8812ea05ff8819ec522780fe657b772
+# Mem_max: 1024
+# Prepared: false
+# Succ: true
+# Plan: tidb_decode_plan('ZJAwCTE4XzEJMAkx')
+# Plan_digest: e5796985ccafe2f71126ed6c0ac939ffa015a8c0744a24b7aee6d587103fd2f7
+use test;
+select * from t where a = 1;
+# Time: 2021-12-13T20:41:01+08:00
+# Query_time: 1.5
+# Digest: 42a1c8aae6f133e934d4bf0147491709a8812ea05ff8819ec522780fe657b772
+# Prev_stmt: insert into t values (1, 'a b')
+select *
+from t where a = 2;
+# Time: 2019-04-28-15:24:04.309074 +0800
+# Query_time: 2
+# Plan:
+select sleep(2);
+# Time: 2021-12-13T20:41:02+08:00
+# Query_time: 0.3
+`
+
+func TestSlowLog(t *testing.T) {
+	records, err := NewParser(strings.NewReader("garbage\n" + slowLog)).WithSource("tidb-slow.log").ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(records))
+
+	r := records[0]
+	assert.True(t, r.Time.Equal(time.Date(2021, 12, 13, 12, 41, 0, 755049432, time.UTC)))
+	assert.Equal(t, parser.TSO(429758679811096577), r.TxnStartTS)
+	assert.Equal(t, "root", r.User)
+	assert.Equal(t, "127.0.0.1", r.Host)
+	assert.Equal(t, uint64(3), r.ConnID)
+	assert.Equal(t, 501200*time.Microsecond, r.QueryTime)
+	assert.Equal(t, "test", r.DB)
+	assert.False(t, r.IsInternal)
+	assert.True(t, r.Succ)
+	assert.Equal(t, int64(1024), r.MemMax)
+	assert.Equal(t, "tidb_decode_plan('ZJAwCTE4XzEJMAkx')", r.Plan)
+	assert.Equal(t, "e5796985ccafe2f71126ed6c0ac939ffa015a8c0744a24b7aee6d587103fd2f7", r.PlanDigest)
+	assert.Equal(t, "select * from t where a = 1;", r.SQL)
+	v, ok := r.Get("Backoff_types")
+	assert.True(t, ok)
+	assert.Equal(t, "[regionMiss tikvRPC]", v)
+	v, _ = r.Get("Total_keys")
+	assert.Equal(t, "100", v)
+	v, _ = r.Get("Backoff_total")
+	assert.Equal(t, "0.01", v)
+	assert.Equal(t, 19, len(r.Fields))
+	assert.Equal(t, parser.LogPosition{Source: "tidb-slow.log", Line: 2, Raw: "# Time: 2021-12-13T20:41:00.755049432+08:00"}, r.Position)
+
+	assert.Equal(t, "insert into t values (1, 'a b')", records[1].PrevStmt)
+	assert.Equal(t, "select *\nfrom t where a = 2;", records[1].SQL)
+	assert.Equal(t, 2019, records[2].Time.Year())
+	assert.Equal(t, "", records[2].Plan)
+	assert.Equal(t, "", records[3].SQL)
+	assert.Equal(t, 30, records[3].Position.Line)
+}
+
+func TestSlowLogMultiStatement(t *testing.T) {
+	log := `# Time: 2021-12-13T20:41:00+08:00
+# Query_time: 1
+select 1;
+# not a field: x
+select 2;
+
+# Time: 2021-12-13T20:41:01+08:00
+# Query_time: 2
+select 3;
+`
+	records, err := NewParser(strings.NewReader(log)).ReadAll()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(records))
+	assert.Equal(t, "select 1;\n# not a field: x\nselect 2;", records[0].SQL)
+	assert.Equal(t, time.Second, records[0].QueryTime)
+	assert.Equal(t, 1, len(records[0].Fields))
+	assert.Equal(t, "select 3;", records[1].SQL)
+}
+
+func TestSlowLogError(t *testing.T) {
+	p := NewParser(strings.NewReader("# Time: 2021-12-13T20:41:00+08:00\n# Query_time: x\nselect 1;\n# Time: 2021-12-13T20:41:01+08:00\nselect 2;\n"))
+	_, err := p.Next()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "at line 2")
+	_, ok := err.(*RecordError)
+	assert.True(t, ok)
+	r, err := p.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, "select 2;", r.SQL)
+	r, err = p.Next()
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+
+	// the read error is returned once
+	buf := bytes.Buffer{}
+	w := gzip.NewWriter(&buf)
+	_, err = w.Write([]byte(slowLog))
+	assert.Nil(t, err)
+	assert.Nil(t, w.Close())
+	gr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-10]))
+	assert.Nil(t, err)
+	p = NewParser(gr).WithSource("slow.log.gz")
+	for err == nil {
+		_, err = p.Next()
+	}
+	_, ok = err.(*RecordError)
+	assert.False(t, ok)
+	assert.Contains(t, err.Error(), "read slow.log.gz")
+	r, err = p.Next()
+	assert.Nil(t, err)
+	assert.Nil(t, r)
+}
+
+func TestSummarizer(t *testing.T) {
+	records, err := NewParser(strings.NewReader(slowLog)).ReadAll()
+	assert.Nil(t, err)
+	s := NewSummarizer()
+	for _, r := range records {
+		s.Add(r)
+	}
+	top, err := s.Top(2, SortByTotal)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(top))
+	assert.Equal(t, "42a1c8aae6f133e934d4bf0147491709a8812ea05ff8819ec522780fe657b772", top[0].Digest)
+	assert.Equal(t, 2, top[0].Count)
+	assert.Equal(t, 2001200*time.Microsecond, top[0].Total)
+	assert.Equal(t, 1500*time.Millisecond, top[0].Max)
+	assert.Equal(t, "select *\nfrom t where a = 2;", top[0].SQL)
+	assert.Equal(t, "select sleep(2);", top[1].SQL)
+
+	top, err = s.Top(0, SortByAvg)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(top))
+	assert.Equal(t, "select sleep(2);", top[0].SQL)
+
+	_, err = s.Top(0, "unknown")
+	assert.NotNil(t, err)
+	key, err := ParseSortKey("max")
+	assert.Nil(t, err)
+	assert.Equal(t, SortByMax, key)
+	_, err = ParseSortKey("unknown")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package slowlog
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// SortKey is an enumeration type for the order of digests.
+type SortKey string
+
+const (
+	SortByTotal SortKey = "total"
+	SortByAvg   SortKey = "avg"
+	SortByMax   SortKey = "max"
+	SortByCount SortKey = "count"
+)
+
+// DigestSummary is the statistics of the slow queries of one digest.
+type DigestSummary struct {
+	Digest string
+	// SQL is the statement of the slowest query as a sample.
+	SQL   string
+	Count int
+	Total time.Duration
+	Max   time.Duration
+	First time.Time
+	Last  time.Time
+}
+
+// Avg returns the average query time.
+func (s *DigestSummary) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+// Summarizer aggregates slow queries by digest.
+type Summarizer struct {
+	digests map[string]*DigestSummary
+}
+
+// NewSummarizer creates an empty *Summarizer.
+func NewSummarizer() *Summarizer {
+	return &Summarizer{digests: make(map[string]*DigestSummary)}
+}
+
+// Add counts the record in the summary of its digest, the SQL is used as the
+// digest of the records without one, eg. of the old versions of TiDB.
+func (s *Summarizer) Add(r *Record) {
+	digest := r.Digest
+	if digest == "" {
+		digest = r.SQL
+	}
+	d, ok := s.digests[digest]
+	if !ok {
+		d = &DigestSummary{Digest: r.Digest, First: r.Time, Last: r.Time}
+		s.digests[digest] = d
+	}
+	d.Count++
+	d.Total += r.QueryTime
+	if r.QueryTime >= d.Max || d.SQL == "" {
+		d.Max = r.QueryTime
+		d.SQL = r.SQL
+	}
+	if r.Time.Before(d.First) {
+		d.First = r.Time
+	}
+	if r.Time.After(d.Last) {
+		d.Last = r.Time
+	}
+}
+
+// ParseSortKey returns the SortKey of the name, eg. total.
+func ParseSortKey(name string) (SortKey, error) {
+	key := SortKey(name)
+	if _, err := key.value(); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// value returns the value of a digest to sort by.
+func (key SortKey) value() (func(d *DigestSummary) int64, error) {
+	switch key {
+	case SortByTotal:
+		return func(d *DigestSummary) int64 { return int64(d.Total) }, nil
+	case SortByAvg:
+		return func(d *DigestSummary) int64 { return int64(d.Avg()) }, nil
+	case SortByMax:
+		return func(d *DigestSummary) int64 { return int64(d.Max) }, nil
+	case SortByCount:
+		return func(d *DigestSummary) int64 { return int64(d.Count) }, nil
+	}
+	return nil, fmt.Errorf("unknown sort key %s", key)
+}
+
+// Top returns at most n digests in the descending order of the key, all of
+// them are returned if n is not positive.
+func (s *Summarizer) Top(n int, key SortKey) ([]*DigestSummary, error) {
+	value, err := key.value()
+	if err != nil {
+		return nil, err
+	}
+
+	xs := make([]*DigestSummary, 0, len(s.digests))
+	for _, d := range s.digests {
+		xs = append(xs, d)
+	}
+	sort.Slice(xs, func(i, j int) bool {
+		vi, vj := value(xs[i]), value(xs[j])
+		if vi != vj {
+			return vi > vj
+		}
+		if xs[i].Digest != xs[j].Digest {
+			return xs[i].Digest < xs[j].Digest
+		}
+		return xs[i].SQL < xs[j].SQL
+	})
+	if n > 0 && len(xs) > n {
+		xs = xs[:n]
+	}
+	return xs, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqllog
+
+import (
+	"sort"
+	"time"
+)
+
+// Session is the history of a connection.
+type Session struct {
+	ConnID uint64
+	// User and Host are the last known ones of the connection.
+	User       string
+	Host       string
+	Start      time.Time
+	End        time.Time
+	Activities []*Activity
+}
+
+// SessionTracker groups the activities by connection. TiDB counts the
+// connection IDs from the start again after a restart, call Restart when
+// the server restarts so that a reused ID begins a new session.
+type SessionTracker struct {
+	open     map[uint64]*Session
+	sessions []*Session
+}
+
+// NewSessionTracker creates an empty *SessionTracker.
+func NewSessionTracker() *SessionTracker {
+	return &SessionTracker{open: make(map[uint64]*Session)}
+}
+
+// Add appends the activity to the session of its connection.
+func (t *SessionTracker) Add(a *Activity) {
+	s := t.open[a.ConnID]
+	if s == nil {
+		s = &Session{ConnID: a.ConnID, Start: a.Time}
+		t.open[a.ConnID] = s
+		t.sessions = append(t.sessions, s)
+	}
+	if a.User != "" {
+		s.User, s.Host = a.User, a.Host
+	}
+	if a.Time.Before(s.Start) {
+		s.Start = a.Time
+	}
+	if a.Time.After(s.End) {
+		s.End = a.Time
+	}
+	s.Activities = append(s.Activities, a)
+}
+
+// Restart ends all the sessions.
+func (t *SessionTracker) Restart() {
+	t.open = make(map[uint64]*Session)
+}
+
+// Sessions returns the sessions ordered by start time, the activities of a
+// session are kept in the order they're added.
+func (t *SessionTracker) Sessions() []*Session {
+	sessions := append([]*Session{}, t.sessions...)
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].Start.Before(sessions[j].Start)
+	})
+	return sessions
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sqllog decodes the SQL statements recorded in the logs of TiDB,
+// ie. the general log enabled by tidb_general_log
+//
+//	[2021/12/13 20:41:00.755 +08:00] [INFO] [session.go:2863] [GENERAL_LOG] [conn=3] [user=root@127.0.0.1] [schemaVersion=28] [txnStartTS=0] [forUpdateTS=0] [isReadConsistency=false] [current_db=test] [txn_mode=PESSIMISTIC] [sql="select 1"]
+//
+// and the output of the audit plugin, which has no message
+//
+//	[2021/12/13 20:41:00.755 +08:00] [INFO] [logger.go:76] [ID=16394017131223040] [TIMESTAMP=2021/12/13 20:41:00.755 +08:00] [EVENT_CLASS=GENERAL] [EVENT_SUBCLASS=] [STATUS_CODE=0] [COST_TIME=1336.083] [HOST=127.0.0.1] [CLIENT_IP=127.0.0.1] [USER=root] [DATABASES="[test]"] [TABLES="[t]"] [SQL_TEXT="select * from t"] [ROWS=0] [CONNECTION_ID=3] [CLIENT_PORT=52044] [PID=1234] [COMMAND=Query] [SQL_STATEMENTS=Select]
+package sqllog
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/pingcap/errors"
+)
+
+// Kind tells which log an Activity is decoded from.
+type Kind string
+
+// The kinds of Activity.
+const (
+	KindGeneral Kind = "general"
+	KindAudit   Kind = "audit"
+)
+
+// Activity is a SQL statement run by a connection.
+type Activity struct {
+	Kind   Kind
+	Time   time.Time
+	ConnID uint64
+	User   string
+	// Host is the client address, it's empty if the log doesn't tell.
+	Host       string
+	DB         string
+	SQL        string
+	TxnStartTS parser.TSO
+	// SchemaVersion and TxnMode are only in the general log.
+	SchemaVersion int64
+	TxnMode       string
+	// Command, Status and Cost are only in the audit log.
+	Command string
+	Status  int64
+	Cost    time.Duration
+
+	// Log is the entry the activity is decoded from.
+	Log *parser.LogEntry
+}
+
+// IsGeneralLog tells if the log is a line of the general log.
+func IsGeneralLog(e *parser.LogEntry) bool {
+	// TiDB before v4.0 quotes the message with brackets
+	return (e.Message == "GENERAL_LOG" || e.Message == "[GENERAL_LOG]") && e.Has("conn")
+}
+
+// IsAuditLog tells if the log is a line of the audit plugin.
+func IsAuditLog(e *parser.LogEntry) bool {
+	return e.Message == "" && e.Has("EVENT_CLASS") && e.Has("CONNECTION_ID")
+}
+
+// Decode decodes the general log or the audit log, it returns (nil, nil)
+// for the other logs.
+func Decode(e *parser.LogEntry) (*Activity, error) {
+	switch {
+	case IsGeneralLog(e):
+		return DecodeGeneralLog(e)
+	case IsAuditLog(e):
+		return DecodeAuditLog(e)
+	}
+	return nil, nil
+}
+
+// DecodeGeneralLog decodes a line of the general log, the fields missing in
+// the older versions of TiDB are left zero.
+func DecodeGeneralLog(e *parser.LogEntry) (*Activity, error) {
+	a := &Activity{Kind: KindGeneral, Time: e.Header.DateTime, Log: e}
+	var err error
+	if a.ConnID, err = e.Uint("conn"); err != nil {
+		return nil, errors.Annotate(err, "decode general log")
+	}
+	// eg. root@127.0.0.1, or root@% before the user is authenticated
+	if user, ok := e.Get("user"); ok && user != "<nil>" {
+		a.User, a.Host = user, ""
+		if i := strings.LastIndexByte(user, '@'); i >= 0 {
+			a.User, a.Host = user[:i], user[i+1:]
+		}
+	}
+	a.DB, _ = e.Get("current_db")
+	a.SQL, _ = e.Get("sql")
+	a.TxnMode, _ = e.Get("txn_mode")
+	if e.Has("txnStartTS") {
+		if a.TxnStartTS, err = e.TSO("txnStartTS"); err != nil {
+			return nil, errors.Annotate(err, "decode general log")
+		}
+	}
+	if e.Has("schemaVersion") {
+		if a.SchemaVersion, err = e.Int("schemaVersion"); err != nil {
+			return nil, errors.Annotate(err, "decode general log")
+		}
+	}
+	return a, nil
+}
+
+// DecodeAuditLog decodes a line of the audit plugin, the first of DATABASES
+// is taken as the DB.
+func DecodeAuditLog(e *parser.LogEntry) (*Activity, error) {
+	a := &Activity{Kind: KindAudit, Time: e.Header.DateTime, Log: e}
+	var err error
+	if a.ConnID, err = e.Uint("CONNECTION_ID"); err != nil {
+		return nil, errors.Annotate(err, "decode audit log")
+	}
+	a.User, _ = e.Get("USER")
+	a.Host, _ = e.Get("CLIENT_IP")
+	a.SQL, _ = e.Get("SQL_TEXT")
+	a.Command, _ = e.Get("COMMAND")
+	if dbs, ok := e.Get("DATABASES"); ok {
+		if xs := strings.Fields(strings.Trim(dbs, "[]")); len(xs) > 0 {
+			a.DB = xs[0]
+		}
+	}
+	if e.Has("STATUS_CODE") {
+		if a.Status, err = e.Int("STATUS_CODE"); err != nil {
+			return nil, errors.Annotate(err, "decode audit log")
+		}
+	}
+	if e.Has("COST_TIME") {
+		// in microseconds
+		us, err := e.Float("COST_TIME")
+		if err != nil {
+			return nil, errors.Annotate(err, "decode audit log")
+		}
+		a.Cost = time.Duration(us * float64(time.Microsecond))
+	}
+	return a, nil
+}
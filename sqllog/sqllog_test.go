@@ -0,0 +1,109 @@
+// Copyright 2021 PingCAP, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sqllog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucklove/tidb-log-parser/parser"
+	"github.com/stretchr/testify/assert"
+)
+
+const tidbLog = `[2021/12/13 20:41:00.755 +08:00] [INFO] [session.go:2863] [GENERAL_LOG] [conn=3] [user=root@127.0.0.1] [schemaVersion=28] [txnStartTS=429758679811096577] [forUpdateTS=0] [isReadConsistency=false] [current_db=test] [txn_mode=PESSIMISTIC] [sql="select * from t"]
+[2021/12/13 20:41:01.000 +08:00] [INFO] [server.go:100] ["new connection"] [conn=5]
+[2021/12/13 20:41:02.000 +08:00] [INFO] [logger.go:76] [ID=16394017131223040] [TIMESTAMP="2021/12/13 20:41:02.000 +08:00"] [EVENT_CLASS=GENERAL] [EVENT_SUBCLASS=] [STATUS_CODE=0] [COST_TIME=1336.083] [HOST=127.0.0.1] [CLIENT_IP=10.0.0.1] [USER=admin] [DATABASES="[test mysql]"] [TABLES="[t]"] [SQL_TEXT="insert into t values (1)"] [ROWS=1] [CONNECTION_ID=5] [CLIENT_PORT=52044] [PID=1234] [COMMAND=Query] [SQL_STATEMENTS=Insert]
+[2021/12/13 20:41:03.000 +08:00] [INFO] [session.go:2863] [GENERAL_LOG] [conn=3] [user=root@127.0.0.1] [schemaVersion=28] [txnStartTS=0] [current_db=test] [sql=commit]
+[2021/12/13 20:41:04.000 +08:00] [INFO] [session.go:2863] [GENERAL_LOG] [conn=x] [sql=commit]
+`
+
+func parseLogs(t *testing.T, s string) []*parser.LogEntry {
+	logs := []*parser.LogEntry{}
+	p := parser.NewStreamParser(strings.NewReader(s))
+	for {
+		log, err := p.Next()
+		assert.Nil(t, err)
+		if log == nil {
+			return logs
+		}
+		logs = append(logs, log)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	logs := parseLogs(t, tidbLog)
+	assert.Len(t, logs, 5)
+
+	a, err := Decode(logs[0])
+	assert.Nil(t, err)
+	assert.Equal(t, KindGeneral, a.Kind)
+	assert.Equal(t, uint64(3), a.ConnID)
+	assert.Equal(t, "root", a.User)
+	assert.Equal(t, "127.0.0.1", a.Host)
+	assert.Equal(t, "test", a.DB)
+	assert.Equal(t, "select * from t", a.SQL)
+	assert.Equal(t, parser.TSO(429758679811096577), a.TxnStartTS)
+	assert.Equal(t, int64(28), a.SchemaVersion)
+	assert.Equal(t, "PESSIMISTIC", a.TxnMode)
+	assert.Equal(t, logs[0], a.Log)
+
+	a, err = Decode(logs[1])
+	assert.Nil(t, err)
+	assert.Nil(t, a)
+
+	a, err = Decode(logs[2])
+	assert.Nil(t, err)
+	assert.Equal(t, KindAudit, a.Kind)
+	assert.Equal(t, uint64(5), a.ConnID)
+	assert.Equal(t, "admin", a.User)
+	assert.Equal(t, "10.0.0.1", a.Host)
+	assert.Equal(t, "test", a.DB)
+	assert.Equal(t, "insert into t values (1)", a.SQL)
+	assert.Equal(t, "Query", a.Command)
+	assert.Equal(t, int64(0), a.Status)
+	assert.Equal(t, 1336083*time.Nanosecond, a.Cost)
+
+	_, err = Decode(logs[4])
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "conn")
+}
+
+func TestSessionTracker(t *testing.T) {
+	logs := parseLogs(t, tidbLog)
+	tracker := NewSessionTracker()
+	for _, log := range logs[:4] {
+		if a, _ := Decode(log); a != nil {
+			tracker.Add(a)
+		}
+	}
+	tracker.Restart()
+	a, err := Decode(logs[0])
+	assert.Nil(t, err)
+	a.Time = a.Time.Add(time.Hour)
+	tracker.Add(a)
+
+	sessions := tracker.Sessions()
+	assert.Len(t, sessions, 3)
+	assert.Equal(t, uint64(3), sessions[0].ConnID)
+	assert.Len(t, sessions[0].Activities, 2)
+	assert.Equal(t, "commit", sessions[0].Activities[1].SQL)
+	assert.Equal(t, logs[0].Header.DateTime, sessions[0].Start)
+	assert.Equal(t, logs[3].Header.DateTime, sessions[0].End)
+	assert.Equal(t, uint64(5), sessions[1].ConnID)
+	assert.Equal(t, "admin", sessions[1].User)
+	assert.Equal(t, uint64(3), sessions[2].ConnID)
+	assert.Len(t, sessions[2].Activities, 1)
+}